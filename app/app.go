@@ -0,0 +1,359 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/eirka/eirka-libs/csrf"
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/assets"
+	local "github.com/eirka/eirka-index/config"
+	c "github.com/eirka/eirka-index/controllers"
+	"github.com/eirka/eirka-index/metrics"
+	m "github.com/eirka/eirka-index/middleware"
+	"github.com/eirka/eirka-index/templates"
+)
+
+// ShutdownTimeout is how long Run waits for requests to finish
+const ShutdownTimeout = 10 * time.Second
+
+// ErrAppExists is returned by New while another App is open
+var ErrAppExists = errors.New("an App is already open in this process, Close it first")
+
+// open is set while an App owns the global settings
+var open atomic.Bool
+
+// App is an eirka-index server built from a config. The middleware and controllers
+// read the global settings, asset manifest and database handle, so only one App can
+// be open in a process at a time.
+type App struct {
+	closed    atomic.Bool
+	settings  *local.Config
+	templates *templates.Renderer
+	prim      *assets.Manifest
+	health    *c.Health
+	engine    *gin.Engine
+	internal  *gin.Engine
+}
+
+// New connects the database, parses the templates and sets up the routes. The
+// middleware and controllers read the global settings so they are replaced with
+// settings, and ErrAppExists is returned until the previous App is closed. If a
+// database handle was already set up, for example a mock in tests, it is used as
+// is and the settings stored in the database are not loaded.
+func New(settings *local.Config) (_ *App, err error) {
+
+	if !open.CompareAndSwap(false, true) {
+		return nil, ErrAppExists
+	}
+
+	// another App can be created if this one fails
+	defer func() {
+		if err != nil {
+			open.Store(false)
+		}
+	}()
+
+	err = settings.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	local.Settings = settings
+
+	if _, err = db.GetDb(); err != nil {
+		err = openDatabase(settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := templates.NewRenderer(settings.Directories.AssetsDir)
+	if err != nil {
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+
+	// integrity digests of the prim files, they are linked without them if the files are missing
+	prim, err := assets.NewManifest(filepath.Join(settings.Directories.AssetsDir, "prim"), settings.Assets.Fingerprint, config.Settings.Prim.JS, config.Settings.Prim.CSS)
+	if err != nil {
+		log.Printf("assets: %v", err)
+	}
+
+	c.Prim = prim
+
+	// the cached page shells are rendered again after the templates reload
+	c.TemplateGeneration = t.Generation
+
+	a := &App{
+		settings:  settings,
+		templates: t,
+		prim:      prim,
+		health: &c.Health{
+			IncludesDir: filepath.Join(settings.Directories.AssetsDir, "includes"),
+		},
+	}
+
+	a.health.Templates = func() bool { return a.templates.Template().Lookup("index") != nil }
+
+	a.engine, err = a.routes()
+	if err != nil {
+		return nil, fmt.Errorf("registering routes: %w", err)
+	}
+
+	// the metrics are served on a separate internal listener
+	if settings.Internal.Port != 0 {
+		a.internal = gin.New()
+		a.internal.Use(gin.Recovery())
+
+		a.internal.GET("/metrics", metrics.Handler)
+	}
+
+	return a, nil
+}
+
+// openDatabase connects to MySQL and loads the settings stored in the database
+func openDatabase(settings *local.Config) (err error) {
+
+	// the eirka-libs setup panics on errors
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("setting up database: %v", r)
+		}
+	}()
+
+	// Database connection settings
+	dbase := db.Database{
+		User:           settings.Database.User,
+		Password:       settings.Database.Password,
+		Proto:          settings.Database.Protocol,
+		Host:           settings.Database.Host,
+		Database:       settings.Database.Database,
+		MaxIdle:        settings.Index.DatabaseMaxIdle,
+		MaxConnections: settings.Index.DatabaseMaxConnections,
+	}
+
+	// Set up DB connection
+	dbase.NewDb()
+
+	// Get limits and stuff from database
+	config.GetDatabaseSettings()
+
+	return
+}
+
+// routes sets up the gin engine for the site
+func (a *App) routes() (*gin.Engine, error) {
+	r := gin.Default()
+
+	// the canonical redirect handles trailing slashes with the imageboard base path
+	r.RedirectTrailingSlash = false
+
+	// record request metrics
+	r.Use(m.Metrics())
+
+	// security headers for every response
+	r.Use(m.SecurityHeaders(a.settings.Index.Headers))
+
+	// gzip and brotli for the clients that accept it
+	if a.settings.Compression.Enabled {
+		r.Use(m.Compress(int(a.settings.Compression.MinSize)))
+	}
+
+	// load template into gin, the renderer swaps the set on reload
+	r.HTMLRender = a.templates
+
+	// the health checks do not depend on the request host
+	r.GET("/healthz", a.health.LivenessController)
+	r.GET("/readyz", a.health.ReadinessController)
+
+	// small deployments can serve the assets without a web server in front
+	if a.settings.Assets.Serve {
+		static := &c.Static{
+			Dir:    a.settings.Directories.AssetsDir,
+			Prim:   a.prim,
+			MaxAge: time.Duration(a.settings.Assets.MaxAge) * time.Second,
+		}
+
+		r.GET("/assets/*path", static.Controller)
+		r.HEAD("/assets/*path", static.Controller)
+	}
+
+	// the admin routes are only enabled with a shared secret
+	if a.settings.Admin.Secret != "" {
+		admin := r.Group("/_admin")
+		admin.Use(m.Admin(a.settings.Admin.Secret))
+
+		admin.GET("/sitemap", c.AdminSitemapController)
+		admin.DELETE("/sitemap", c.AdminPurgeController)
+		admin.DELETE("/sitemap/:host", c.AdminPurgeHostController)
+		admin.POST("/sitemap/:host", c.AdminReloadController)
+	}
+
+	site := r.Group("/")
+	// use the details middleware
+	site.Use(m.Details())
+
+	// robots and sitemaps for search engines
+	site.GET("/robots.txt", c.RobotsController)
+	site.GET("/sitemap.xml", c.SitemapIndexController)
+	site.GET("/sitemap/:section/:page", c.SitemapController)
+
+	// feeds of the latest threads and tags
+	site.GET("/feed/threads.atom", c.ThreadFeedController)
+	site.GET("/feed/threads.rss", c.ThreadFeedController)
+	site.GET("/feed/tag/:id", c.TagFeedController)
+
+	// browsers send content security policy violations here
+	if a.settings.CSP.Enabled {
+		site.POST("/csp-report", c.CSPReportController)
+	}
+
+	pages := site.Group("/")
+	// redirects to the canonical url and generates our csrf cookie
+	pages.Use(c.CanonicalRedirect, csrf.Cookie())
+
+	// these routes are handled by angularjs
+	err := pageRoutes(pages, a.settings.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	// if nothing matches
+	r.NoRoute(m.Details(), c.CanonicalRedirect, csrf.Cookie(), c.ErrorController)
+
+	return r, nil
+}
+
+// pageRoutes registers the route table, gin panics on conflicting paths
+func pageRoutes(pages *gin.RouterGroup, routes []local.Route) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	for _, route := range routes {
+		controller, err := c.RouteController(route)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", route.Path, err)
+		}
+
+		if len(route.Params()) > 0 {
+			pages.GET(route.Path, c.ValidateParams, controller)
+			continue
+		}
+
+		pages.GET(route.Path, controller)
+	}
+
+	return nil
+}
+
+// Close releases the global settings so another App can be created, the app
+// should not serve requests after it is closed
+func (a *App) Close() {
+	if a.closed.CompareAndSwap(false, true) {
+		open.Store(false)
+	}
+}
+
+// Handler returns the handler for the site listener
+func (a *App) Handler() http.Handler {
+	return a.engine
+}
+
+// InternalHandler returns the handler for the internal listener, nil if it is disabled
+func (a *App) InternalHandler() http.Handler {
+	if a.internal == nil {
+		return nil
+	}
+	return a.internal
+}
+
+// Servers returns the http servers for the configured listeners
+func (a *App) Servers() []*http.Server {
+	servers := []*http.Server{{
+		Addr:              fmt.Sprintf("%s:%d", a.settings.Index.Host, a.settings.Index.Port),
+		ReadHeaderTimeout: 2 * time.Second,
+		Handler:           a.engine,
+	}}
+
+	if a.internal != nil {
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", a.settings.Internal.Host, a.settings.Internal.Port),
+			ReadHeaderTimeout: 2 * time.Second,
+			Handler:           a.internal,
+		})
+	}
+
+	return servers
+}
+
+// Drain marks the app as not ready before shutting down
+func (a *App) Drain() {
+	a.health.Drain()
+}
+
+// WatchTemplates reloads the templates when the includes change and rehashes the
+// prim files until ctx is cancelled
+func (a *App) WatchTemplates(ctx context.Context) {
+	if a.settings.Index.TemplateReload == 0 {
+		return
+	}
+
+	interval := time.Duration(a.settings.Index.TemplateReload) * time.Second
+
+	go a.prim.Watch(ctx, interval)
+
+	a.templates.Watch(ctx, interval)
+}
+
+// Run serves the listeners until ctx is cancelled and then shuts them down gracefully
+func (a *App) Run(ctx context.Context) error {
+	servers := a.Servers()
+
+	go a.WatchTemplates(ctx)
+
+	errs := make(chan error, len(servers))
+
+	for _, s := range servers {
+		go func(s *http.Server) {
+			err := s.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}(s)
+	}
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+		// a listener failed so stop the others
+	}
+
+	a.Drain()
+
+	shutdown, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	for _, s := range servers {
+		if serr := s.Shutdown(shutdown); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+	m "github.com/eirka/eirka-index/middleware"
+)
+
+// testSettings returns a valid config with an includes directory
+func testSettings(t *testing.T) *local.Config {
+	assets := t.TempDir()
+
+	assert.NoError(t, os.Mkdir(filepath.Join(assets, "includes"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(assets, "includes", "head.tmpl"), []byte(`[[define "headinclude"]]<meta name="include" content="head" />[[end]]`), 0644))
+
+	settings := local.Defaults()
+	settings.Database.Database = "prim"
+	settings.Directories.AssetsDir = assets
+
+	return settings
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(local.Defaults())
+	assert.Error(t, err, "An invalid config should be returned as an error")
+}
+
+func TestNewSingleApp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	a, err := New(testSettings(t))
+	assert.NoError(t, err, "An error was not expected")
+
+	_, err = New(testSettings(t))
+	assert.ErrorIs(t, err, ErrAppExists, "A second App should not replace the global settings")
+
+	a.Close()
+	a.Close()
+
+	b, err := New(testSettings(t))
+	assert.NoError(t, err, "An App should be created after the previous one is closed")
+	b.Close()
+}
+
+func TestNewConflictingRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	settings := testSettings(t)
+	settings.Routes = []local.Route{{Path: "/board/:id"}, {Path: "/board/:page"}}
+
+	_, err = New(settings)
+	assert.ErrorContains(t, err, "registering routes", "Routes gin can not register should be returned as an error")
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+	defer m.PurgeSites()
+
+	a, err := New(testSettings(t))
+	assert.NoError(t, err, "An error was not expected")
+	defer a.Close()
+	assert.Nil(t, a.InternalHandler(), "Internal listener should be disabled without a port")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	a.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Health check should not need a host")
+
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("test.board").
+		WillReturnRows(sqlmock.NewRows([]string{"ib_id", "ib_title", "ib_description", "ib_nsfw", "ib_api", "ib_img", "ib_style", "ib_logo", "ib_discord"}).
+			AddRow(1, "Test Board", "a test board", false, "api.test.board", "img.test.board", "style.css", "logo.png", ""))
+	mock.ExpectQuery(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != \?`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ib_title", "ib_domain"}))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Host = "test.board"
+	a.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, "Index should render")
+	assert.Contains(t, w.Body.String(), "<title ng-bind=\"page.title\">Test Board</title>")
+	assert.Contains(t, w.Body.String(), "<meta name=\"include\" content=\"head\" />", "Includes should be loaded from the assets directory")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	// find a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "An error was not expected")
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	settings := testSettings(t)
+	settings.Index.Port = uint(port)
+
+	a, err := New(settings)
+	assert.NoError(t, err, "An error was not expected")
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/healthz", port))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond, "Server should start")
+
+	cancel()
+
+	select {
+	case err = <-done:
+		assert.NoError(t, err, "Run should shut down cleanly")
+	case <-time.After(ShutdownTimeout):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,201 @@
+package assets
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HashLength is the amount of hex characters of the digest put in fingerprinted names
+const HashLength = 12
+
+// Asset is a file with its subresource integrity digest
+type Asset struct {
+	// Name is the file name in the directory
+	Name string
+	// URL is the name used in the page, with the content hash when fingerprinting
+	URL string
+	// Integrity is the sha384 digest for the integrity attribute
+	Integrity string
+
+	modified time.Time
+	size     int64
+}
+
+// Manifest holds the digests of the files in a directory
+type Manifest struct {
+	dir         string
+	fingerprint bool
+
+	mu      sync.Mutex
+	names   []string
+	current atomic.Pointer[map[string]Asset]
+}
+
+// NewManifest hashes the named files in dir, fingerprint adds the content hash to
+// the urls. The manifest is usable even when some files could not be hashed.
+func NewManifest(dir string, fingerprint bool, names ...string) (*Manifest, error) {
+	m := &Manifest{
+		dir:         dir,
+		fingerprint: fingerprint,
+		names:       names,
+	}
+
+	m.current.Store(&map[string]Asset{})
+
+	return m, m.Reload()
+}
+
+// Lookup returns the asset for a file name, unknown files are returned without a digest
+func (m *Manifest) Lookup(name string) Asset {
+	if m != nil {
+		if asset, ok := (*m.current.Load())[name]; ok {
+			return asset
+		}
+	}
+
+	return Asset{Name: name, URL: name}
+}
+
+// Resolve returns the file name for a fingerprinted url
+func (m *Manifest) Resolve(url string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+
+	for _, asset := range *m.current.Load() {
+		if asset.URL == url {
+			return asset.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// Reload hashes the files that changed since the last reload. A file that can
+// not be read keeps its last digest, or is served without one, and is reported.
+func (m *Manifest) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := *m.current.Load()
+	assets := make(map[string]Asset, len(m.names))
+
+	var errs []error
+
+	for _, name := range m.names {
+		if name == "" {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(m.dir, name))
+		if err != nil {
+			errs = append(errs, err)
+			if old, ok := current[name]; ok {
+				assets[name] = old
+			}
+			continue
+		}
+
+		if old, ok := current[name]; ok && old.modified.Equal(info.ModTime()) && old.size == info.Size() {
+			assets[name] = old
+			continue
+		}
+
+		asset, err := m.hash(name)
+		if err != nil {
+			errs = append(errs, err)
+			if old, ok := current[name]; ok {
+				assets[name] = old
+			}
+			continue
+		}
+
+		asset.modified = info.ModTime()
+		asset.size = info.Size()
+
+		assets[name] = asset
+	}
+
+	m.current.Store(&assets)
+
+	return errors.Join(errs...)
+}
+
+// Watch rehashes the files every interval until ctx is cancelled
+func (m *Manifest) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := m.Reload()
+
+		// only log when something new goes wrong
+		var current string
+		if err != nil {
+			current = err.Error()
+		}
+
+		if current != "" && current != last {
+			log.Printf("assets: %v", err)
+		}
+
+		last = current
+	}
+}
+
+// hash computes the digest of a file
+func (m *Manifest) hash(name string) (Asset, error) {
+	file, err := os.Open(filepath.Join(m.dir, name))
+	if err != nil {
+		return Asset{}, err
+	}
+	defer file.Close()
+
+	h := sha512.New384()
+
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return Asset{}, fmt.Errorf("hashing %s: %w", name, err)
+	}
+
+	sum := h.Sum(nil)
+
+	asset := Asset{
+		Name:      name,
+		URL:       name,
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(sum),
+	}
+
+	if m.fingerprint {
+		asset.URL = Fingerprint(name, hex.EncodeToString(sum)[:HashLength])
+	}
+
+	return asset, nil
+}
+
+// Fingerprint puts the hash before the extension, prim.min.js becomes prim.min.<hash>.js
+func Fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
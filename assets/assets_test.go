@@ -0,0 +1,88 @@
+package assets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAsset(t *testing.T, dir, name, body string, modified time.Time) {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0644))
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	start := time.Now().Add(-time.Hour)
+	writeAsset(t, dir, "prim.js", "alert(1)", start)
+	writeAsset(t, dir, "prim.css", "body{}", start)
+
+	m, err := NewManifest(dir, false, "prim.js", "prim.css", "")
+	assert.NoError(t, err, "An error was not expected")
+
+	// openssl dgst -sha384 -binary | openssl base64 -A
+	assert.Equal(t, Asset{
+		Name:      "prim.js",
+		URL:       "prim.js",
+		Integrity: "sha384-HT2E9NfWiuQ/w1PRai+hTyqW16NIoCGA/m8VQDUopfAtcz6YQjtsMmQd5uRbVDpW",
+	}, withoutState(m.Lookup("prim.js")))
+
+	assert.Equal(t, Asset{Name: "other.js", URL: "other.js"}, m.Lookup("other.js"), "Unknown files should not have a digest")
+
+	var empty *Manifest
+	assert.Equal(t, Asset{Name: "prim.js", URL: "prim.js"}, empty.Lookup("prim.js"), "Missing manifest should not have digests")
+
+	old := m.Lookup("prim.js").Integrity
+
+	writeAsset(t, dir, "prim.js", "alert(2)", start.Add(time.Minute))
+	assert.NoError(t, m.Reload(), "An error was not expected")
+	assert.NotEqual(t, old, m.Lookup("prim.js").Integrity, "Changed file should be rehashed")
+
+	// a missing file keeps its digest
+	current := m.Lookup("prim.css")
+	assert.NoError(t, os.Remove(filepath.Join(dir, "prim.css")))
+	assert.Error(t, m.Reload(), "Missing file should be reported")
+	assert.Equal(t, current, m.Lookup("prim.css"), "Missing file should keep its digest")
+}
+
+func TestManifestMissing(t *testing.T) {
+	m, err := NewManifest(t.TempDir(), false, "prim.js")
+	assert.Error(t, err, "Missing file should be reported")
+	assert.NotNil(t, m, "Manifest should be usable")
+	assert.Empty(t, m.Lookup("prim.js").Integrity, "Missing file should not have a digest")
+}
+
+func TestManifestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	writeAsset(t, dir, "prim.min.js", "alert(1)", time.Now())
+
+	m, err := NewManifest(dir, true, "prim.min.js")
+	assert.NoError(t, err, "An error was not expected")
+
+	asset := m.Lookup("prim.min.js")
+	assert.Equal(t, "prim.min.1d3d84f4d7d6.js", asset.URL, "Url should have the content hash")
+
+	name, ok := m.Resolve(asset.URL)
+	assert.True(t, ok, "Fingerprinted url should resolve")
+	assert.Equal(t, "prim.min.js", name)
+
+	_, ok = m.Resolve("prim.min.000000000000.js")
+	assert.False(t, ok, "Old fingerprint should not resolve")
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, "prim.abc.js", Fingerprint("prim.js", "abc"))
+	assert.Equal(t, "prim.min.abc.css", Fingerprint("prim.min.css", "abc"))
+	assert.Equal(t, "prim.abc", Fingerprint("prim", "abc"))
+}
+
+func withoutState(asset Asset) Asset {
+	asset.modified = time.Time{}
+	asset.size = 0
+	return asset
+}
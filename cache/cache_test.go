@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheGetSet(t *testing.T) {
+	c := New[string](2, time.Minute)
+
+	_, ok := c.Get("one")
+	assert.False(t, ok, "Empty cache should miss")
+
+	c.Set("one", "1")
+	value, ok := c.Get("one")
+	assert.True(t, ok, "Set value should hit")
+	assert.Equal(t, "1", value)
+
+	c.Set("one", "uno")
+	value, _ = c.Get("one")
+	assert.Equal(t, "uno", value, "Set should replace the value")
+	assert.Equal(t, 1, c.Len())
+
+	c.Delete("one")
+	_, ok = c.Get("one")
+	assert.False(t, ok, "Deleted value should miss")
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := New[int](2, time.Minute)
+
+	c.Set("one", 1)
+	c.Set("two", 2)
+
+	// touch one so two is the least recently used
+	c.Get("one")
+
+	c.Set("three", 3)
+
+	assert.Equal(t, 2, c.Len(), "Cache should stay bounded")
+
+	_, ok := c.Get("two")
+	assert.False(t, ok, "Least recently used entry should be evicted")
+
+	_, ok = c.Get("one")
+	assert.True(t, ok, "Recently used entry should be kept")
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len(), "Purge should empty the cache")
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New[int](10, time.Minute)
+
+	start := time.Now()
+	c.now = func() time.Time { return start }
+
+	c.Set("one", 1)
+
+	c.now = func() time.Time { return start.Add(59 * time.Second) }
+	_, ok := c.Get("one")
+	assert.True(t, ok, "Entry should be fresh before the ttl")
+
+	c.now = func() time.Time { return start.Add(time.Minute) }
+	_, ok = c.Get("one")
+	assert.False(t, ok, "Entry should expire after the ttl")
+	assert.Equal(t, 0, c.Len(), "Expired entry should be removed")
+}
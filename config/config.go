@@ -1,38 +1,8 @@
 package config
 
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-)
-
 func init() {
-	file, err := os.Open("/etc/pram/pram.conf")
-	if err != nil {
-		// file was not found so use default settings
-		Settings = &Config{
-			Index: Index{
-				Host: "127.0.0.1",
-				Port: 5005,
-			},
-			Directories: Directories{
-				AssetsDir: "/data/prim/assets/",
-			},
-		}
-		return
-	}
-
-	// if the file is found fill settings with json
-	Settings = &Config{}
-
-	decoder := json.NewDecoder(file)
-
-	err = decoder.Decode(&Settings)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
+	// start with the defaults, the config file is read by Load
+	Settings = Defaults()
 }
 
 // Settings holds the current config options
@@ -44,6 +14,15 @@ type Config struct {
 	Index       Index
 	Directories Directories
 	Database    Database
+	Admin       Admin
+	Sitemap     Sitemap
+	Robots      Robots
+	Internal    Internal
+	CSP         CSP
+	Assets      Assets
+	Compression Compression
+	// Routes are the pages of the frontend, a config file replaces the whole list
+	Routes []Route
 }
 
 // Index sets what the daemon listens on
@@ -52,6 +31,41 @@ type Index struct {
 	Port                   uint
 	DatabaseMaxIdle        int
 	DatabaseMaxConnections int
+	// SiteCacheTTL is how many seconds imageboard settings are cached before being refreshed
+	SiteCacheTTL uint
+	// TemplateReload is how many seconds between checks of the includes directory, zero disables it
+	TemplateReload uint
+	// CacheableShell keeps the csrf token and the other per request values out of the
+	// pages so they are sent with an etag and answered with 304 when unchanged
+	CacheableShell bool
+	// ShellCache renders a page once for each imageboard and splices in the per request values
+	ShellCache bool
+	// CheckContent looks up the threads, tags and images of a page in the database so
+	// missing ones get a 404 and deleted ones a 410 instead of an empty page
+	CheckContent bool
+	// Scheme is http or https for the links the pages, feeds and sitemaps are built with, when
+	// empty it is taken from the connection or the X-Forwarded-Proto header of a private proxy
+	Scheme string
+	// Noscript renders the posts of the routes with a Noscript list for clients without javascript
+	Noscript bool
+	// Headers are the security headers sent with every response
+	Headers Headers
+}
+
+// Headers holds the security headers, empty values are not sent
+type Headers struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds, zero disables it
+	HSTSMaxAge            uint
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// NoSniff sends X-Content-Type-Options: nosniff
+	NoSniff           bool
+	ReferrerPolicy    string
+	PermissionsPolicy string
+	// FrameOptions is DENY or SAMEORIGIN and also sets the frame-ancestors policy
+	FrameOptions string
+	// Boards replaces the headers for a domain
+	Boards map[string]Headers
 }
 
 // Database holds the connection settings for MySQL
@@ -63,6 +77,69 @@ type Database struct {
 	Database string
 }
 
+// Internal sets the listener for the metrics endpoint, it is disabled without a port
+type Internal struct {
+	Host string
+	Port uint
+}
+
+// Admin holds the settings for the internal admin routes
+type Admin struct {
+	// Secret is the shared bearer token, the admin routes are disabled when empty
+	Secret string
+}
+
+// Sitemap holds the settings for the generated sitemap.xml
+type Sitemap struct {
+	// ExcludeNsfw disables the sitemap for adult imageboards
+	ExcludeNsfw bool
+	// PageSize is the amount of urls in a sitemap page, at most 50000
+	PageSize uint
+}
+
+// Robots holds the settings for the generated robots.txt
+type Robots struct {
+	// BlockNsfw disallows all crawling on adult imageboards
+	BlockNsfw bool
+	// Disallow are extra paths blocked on every imageboard
+	Disallow []string
+	// Boards replaces the generated robots.txt for a domain
+	Boards map[string]string
+}
+
+// CSP holds the settings for the Content-Security-Policy header sent with the pages
+type CSP struct {
+	// Enabled sends the header and adds a nonce to the scripts
+	Enabled bool
+	// ReportOnly sends Content-Security-Policy-Report-Only so violations are only reported
+	ReportOnly bool
+	// Sources are added to the generated directives, keyed by directive name like "script-src"
+	Sources map[string][]string
+	// ReportURI is where violations are sent, the /csp-report collector when empty
+	ReportURI string
+}
+
+// Assets holds the settings for the stylesheets and scripts linked from the pages
+type Assets struct {
+	// Fingerprint puts the content hash in the prim file names
+	Fingerprint bool
+	// Serve serves AssetsDir on /assets so no other web server is needed
+	Serve bool
+	// MaxAge is how many seconds served files without a fingerprint are cached
+	MaxAge uint
+	// FontAwesome is the font-awesome stylesheet url, empty leaves it out
+	FontAwesome string
+	// FontAwesomeIntegrity is the subresource integrity digest of the stylesheet, like sha384-...
+	FontAwesomeIntegrity string
+}
+
+// Compression holds the settings for the gzip and brotli response encoding
+type Compression struct {
+	Enabled bool
+	// MinSize is the smallest body in bytes that is compressed
+	MinSize uint
+}
+
 // Directories sets where files will be stored locally
 type Directories struct {
 	AssetsDir string
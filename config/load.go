@@ -0,0 +1,318 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultPath is where the config file is read from when no path is given
+const DefaultPath = "/etc/pram/pram.conf"
+
+// EnvPath is the environment variable that selects the config file
+const EnvPath = "EIRKA_INDEX_CONFIG"
+
+// redacted replaces secrets when the config is printed
+const redacted = "REDACTED"
+
+// Defaults returns the settings used when nothing is configured
+func Defaults() *Config {
+	return &Config{
+		Index: Index{
+			Host:           "127.0.0.1",
+			Port:           5005,
+			SiteCacheTTL:   300,
+			TemplateReload: 5,
+			CacheableShell: true,
+			ShellCache:     true,
+			Headers: Headers{
+				HSTSMaxAge:        15552000,
+				NoSniff:           true,
+				ReferrerPolicy:    "strict-origin-when-cross-origin",
+				PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=()",
+				FrameOptions:      "SAMEORIGIN",
+			},
+		},
+		Directories: Directories{
+			AssetsDir: "/data/prim/assets/",
+		},
+		Database: Database{
+			Protocol: "tcp",
+		},
+		Sitemap: Sitemap{
+			PageSize: 50000,
+		},
+		Compression: Compression{
+			Enabled: true,
+			MinSize: 1024,
+		},
+		Assets: Assets{
+			MaxAge:      3600,
+			FontAwesome: "https://maxcdn.bootstrapcdn.com/font-awesome/4.4.0/css/font-awesome.min.css",
+		},
+		Routes: DefaultRoutes(),
+	}
+}
+
+// Load layers the config file and the environment over the defaults. The file is
+// taken from path, then EIRKA_INDEX_CONFIG, then the default path which may be missing.
+func Load(path string) (*Config, error) {
+	settings := Defaults()
+
+	explicit := true
+
+	if path == "" {
+		path = os.Getenv(EnvPath)
+	}
+
+	if path == "" {
+		path = DefaultPath
+		explicit = false
+	}
+
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+		// no config file so only the defaults and environment are used
+	case err != nil:
+		return nil, fmt.Errorf("opening config: %w", err)
+	default:
+		defer file.Close()
+
+		// json would decode the routes over the default ones and keep their other fields
+		settings.Routes = nil
+
+		// the file only replaces the values it sets
+		err = json.NewDecoder(file).Decode(settings)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+
+		if settings.Routes == nil {
+			settings.Routes = DefaultRoutes()
+		}
+	}
+
+	err = settings.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// envOverride sets a config field from an environment variable
+type envOverride struct {
+	name string
+	set  func(c *Config, value string) error
+}
+
+// envOverrides are the fields that can be set from the environment
+var envOverrides = []envOverride{
+	{"EIRKA_INDEX_HOST", func(c *Config, v string) error { c.Index.Host = v; return nil }},
+	{"EIRKA_INDEX_PORT", func(c *Config, v string) error { return parseUint(v, &c.Index.Port) }},
+	{"EIRKA_INDEX_SITE_CACHE_TTL", func(c *Config, v string) error { return parseUint(v, &c.Index.SiteCacheTTL) }},
+	{"EIRKA_INDEX_TEMPLATE_RELOAD", func(c *Config, v string) error { return parseUint(v, &c.Index.TemplateReload) }},
+	{"EIRKA_INDEX_CACHEABLE_SHELL", func(c *Config, v string) error { return parseBool(v, &c.Index.CacheableShell) }},
+	{"EIRKA_INDEX_SHELL_CACHE", func(c *Config, v string) error { return parseBool(v, &c.Index.ShellCache) }},
+	{"EIRKA_INDEX_CHECK_CONTENT", func(c *Config, v string) error { return parseBool(v, &c.Index.CheckContent) }},
+	{"EIRKA_INDEX_NOSCRIPT", func(c *Config, v string) error { return parseBool(v, &c.Index.Noscript) }},
+	{"EIRKA_INDEX_SCHEME", func(c *Config, v string) error { c.Index.Scheme = v; return nil }},
+	{"EIRKA_INDEX_DB_MAX_IDLE", func(c *Config, v string) error { return parseInt(v, &c.Index.DatabaseMaxIdle) }},
+	{"EIRKA_INDEX_DB_MAX_CONNECTIONS", func(c *Config, v string) error { return parseInt(v, &c.Index.DatabaseMaxConnections) }},
+	{"EIRKA_INDEX_ASSETS_DIR", func(c *Config, v string) error { c.Directories.AssetsDir = v; return nil }},
+	{"EIRKA_INDEX_ADMIN_SECRET", func(c *Config, v string) error { c.Admin.Secret = v; return nil }},
+	{"EIRKA_INDEX_INTERNAL_HOST", func(c *Config, v string) error { c.Internal.Host = v; return nil }},
+	{"EIRKA_INDEX_INTERNAL_PORT", func(c *Config, v string) error { return parseUint(v, &c.Internal.Port) }},
+	{"EIRKA_INDEX_SITEMAP_EXCLUDE_NSFW", func(c *Config, v string) error { return parseBool(v, &c.Sitemap.ExcludeNsfw) }},
+	{"EIRKA_INDEX_SITEMAP_PAGE_SIZE", func(c *Config, v string) error { return parseUint(v, &c.Sitemap.PageSize) }},
+	{"EIRKA_INDEX_ROBOTS_BLOCK_NSFW", func(c *Config, v string) error { return parseBool(v, &c.Robots.BlockNsfw) }},
+	{"EIRKA_INDEX_HSTS_MAX_AGE", func(c *Config, v string) error { return parseUint(v, &c.Index.Headers.HSTSMaxAge) }},
+	{"EIRKA_INDEX_FRAME_OPTIONS", func(c *Config, v string) error { c.Index.Headers.FrameOptions = v; return nil }},
+	{"EIRKA_INDEX_ASSETS_FINGERPRINT", func(c *Config, v string) error { return parseBool(v, &c.Assets.Fingerprint) }},
+	{"EIRKA_INDEX_ASSETS_SERVE", func(c *Config, v string) error { return parseBool(v, &c.Assets.Serve) }},
+	{"EIRKA_INDEX_COMPRESSION", func(c *Config, v string) error { return parseBool(v, &c.Compression.Enabled) }},
+	{"EIRKA_INDEX_CSP_ENABLED", func(c *Config, v string) error { return parseBool(v, &c.CSP.Enabled) }},
+	{"EIRKA_INDEX_CSP_REPORT_ONLY", func(c *Config, v string) error { return parseBool(v, &c.CSP.ReportOnly) }},
+	{"EIRKA_DB_HOST", func(c *Config, v string) error { c.Database.Host = v; return nil }},
+	{"EIRKA_DB_PROTOCOL", func(c *Config, v string) error { c.Database.Protocol = v; return nil }},
+	{"EIRKA_DB_USER", func(c *Config, v string) error { c.Database.User = v; return nil }},
+	{"EIRKA_DB_PASSWORD", func(c *Config, v string) error { c.Database.Password = v; return nil }},
+	{"EIRKA_DB_DATABASE", func(c *Config, v string) error { c.Database.Database = v; return nil }},
+}
+
+// ApplyEnv overrides fields with the environment variables that are set
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, override := range envOverrides {
+		value, ok := lookup(override.name)
+		if !ok {
+			continue
+		}
+
+		err := override.set(c, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", override.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the settings and returns every problem found
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Index.Port == 0 || c.Index.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid Index.Port %d", c.Index.Port))
+	}
+
+	if c.Internal.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid Internal.Port %d", c.Internal.Port))
+	}
+
+	if c.Internal.Port != 0 && c.Internal.Port == c.Index.Port && c.Internal.Host == c.Index.Host {
+		errs = append(errs, errors.New("the Internal listener can not use the same address as Index"))
+	}
+
+	if c.Index.Scheme != "" && c.Index.Scheme != "http" && c.Index.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("invalid Index.Scheme %q", c.Index.Scheme))
+	}
+
+	if c.Index.DatabaseMaxIdle < 0 {
+		errs = append(errs, errors.New("negative Index.DatabaseMaxIdle"))
+	}
+
+	if c.Index.DatabaseMaxConnections < 0 {
+		errs = append(errs, errors.New("negative Index.DatabaseMaxConnections"))
+	}
+
+	if c.Directories.AssetsDir == "" {
+		errs = append(errs, errors.New("missing Directories.AssetsDir"))
+	}
+
+	if c.Database.Protocol == "" {
+		errs = append(errs, errors.New("missing Database.Protocol"))
+	}
+
+	if c.Database.Database == "" {
+		errs = append(errs, errors.New("missing Database.Database"))
+	}
+
+	if c.Sitemap.PageSize > 50000 {
+		errs = append(errs, fmt.Errorf("too large Sitemap.PageSize %d, the limit is 50000", c.Sitemap.PageSize))
+	}
+
+	if !validFrameOptions(c.Index.Headers.FrameOptions) {
+		errs = append(errs, fmt.Errorf("invalid Index.Headers.FrameOptions %q", c.Index.Headers.FrameOptions))
+	}
+
+	for domain, headers := range c.Index.Headers.Boards {
+		if !validFrameOptions(headers.FrameOptions) {
+			errs = append(errs, fmt.Errorf("invalid Index.Headers.Boards[%s].FrameOptions %q", domain, headers.FrameOptions))
+		}
+
+		if len(headers.Boards) > 0 {
+			errs = append(errs, fmt.Errorf("nested Index.Headers.Boards[%s].Boards", domain))
+		}
+	}
+
+	if c.Assets.FontAwesomeIntegrity != "" && !validIntegrity(c.Assets.FontAwesomeIntegrity) {
+		errs = append(errs, fmt.Errorf("invalid Assets.FontAwesomeIntegrity %q", c.Assets.FontAwesomeIntegrity))
+	}
+
+	for directive, sources := range c.CSP.Sources {
+		if !validCSPDirective(directive) {
+			errs = append(errs, fmt.Errorf("invalid CSP.Sources directive %q", directive))
+		}
+
+		for _, source := range sources {
+			if source == "" || strings.ContainsAny(source, ";, \t\r\n") {
+				errs = append(errs, fmt.Errorf("invalid CSP.Sources source %q for %s", source, directive))
+			}
+		}
+	}
+
+	errs = append(errs, validateRoutes(c.Routes)...)
+
+	return errors.Join(errs...)
+}
+
+// validFrameOptions checks for the X-Frame-Options values that have a frame-ancestors equivalent
+func validFrameOptions(value string) bool {
+	switch value {
+	case "", "DENY", "SAMEORIGIN":
+		return true
+	}
+	return false
+}
+
+// validIntegrity checks for a supported subresource integrity hash
+func validIntegrity(integrity string) bool {
+	for _, prefix := range []string{"sha256-", "sha384-", "sha512-"} {
+		if strings.HasPrefix(integrity, prefix) && len(integrity) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCSPDirective checks a directive name only has lowercase letters and dashes
+func validCSPDirective(directive string) bool {
+	if directive == "" {
+		return false
+	}
+
+	for _, r := range directive {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Redacted returns a copy of the settings with the secrets removed
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	if copied.Database.Password != "" {
+		copied.Database.Password = redacted
+	}
+
+	if copied.Admin.Secret != "" {
+		copied.Admin.Secret = redacted
+	}
+
+	return &copied
+}
+
+func parseUint(value string, field *uint) error {
+	parsed, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return err
+	}
+	*field = uint(parsed)
+	return nil
+}
+
+func parseInt(value string, field *int) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*field = parsed
+	return nil
+}
+
+func parseBool(value string, field *bool) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*field = parsed
+	return nil
+}
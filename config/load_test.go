@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "pram.conf")
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfig(t, `{"Index":{"Port":6000},"Database":{"Database":"prim","Password":"file"}}`)
+
+	t.Setenv("EIRKA_DB_PASSWORD", "env")
+	t.Setenv("EIRKA_INDEX_SITE_CACHE_TTL", "60")
+
+	settings, err := Load(path)
+	assert.NoError(t, err, "An error was not expected")
+
+	assert.Equal(t, uint(6000), settings.Index.Port, "File should override the default")
+	assert.Equal(t, "127.0.0.1", settings.Index.Host, "Defaults should be kept when the file does not set them")
+	assert.Equal(t, "prim", settings.Database.Database, "File values should be loaded")
+	assert.Equal(t, "env", settings.Database.Password, "Environment should override the file")
+	assert.Equal(t, uint(60), settings.Index.SiteCacheTTL, "Environment should override the default")
+
+	assert.NoError(t, settings.Validate(), "Loaded config should be valid")
+}
+
+func TestLoadPathFromEnv(t *testing.T) {
+	path := writeConfig(t, `{"Index":{"Port":7000}}`)
+
+	t.Setenv(EnvPath, path)
+
+	settings, err := Load("")
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, uint(7000), settings.Index.Port, "Config path should be taken from the environment")
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.conf"))
+	assert.Error(t, err, "An explicit missing file should error")
+
+	_, err = Load(writeConfig(t, `{"Index":`))
+	assert.Error(t, err, "Bad json should error instead of exiting")
+
+	t.Setenv("EIRKA_INDEX_PORT", "not a number")
+
+	_, err = Load(writeConfig(t, `{}`))
+	assert.ErrorContains(t, err, "EIRKA_INDEX_PORT", "Bad environment values should name the variable")
+}
+
+func TestValidate(t *testing.T) {
+	settings := Defaults()
+	settings.Index.Port = 70000
+	settings.Internal.Port = 70000
+	settings.Sitemap.PageSize = 60000
+	settings.Index.Scheme = "HTTPS://"
+	settings.Index.Headers.FrameOptions = "ALLOW-FROM https://test.com"
+	settings.Assets.FontAwesomeIntegrity = "md5-abc"
+	settings.CSP.Sources = map[string][]string{
+		"Script Src": {"cdn.example.com"},
+		"img-src":    {"cdn.example.com; script-src *"},
+	}
+
+	err := settings.Validate()
+	assert.ErrorContains(t, err, "invalid Index.Port 70000")
+	assert.ErrorContains(t, err, "invalid Internal.Port 70000")
+	assert.ErrorContains(t, err, "missing Database.Database")
+	assert.ErrorContains(t, err, "too large Sitemap.PageSize 60000")
+	assert.ErrorContains(t, err, `invalid Index.Scheme "HTTPS://"`)
+	assert.ErrorContains(t, err, `invalid Index.Headers.FrameOptions "ALLOW-FROM https://test.com"`)
+	assert.ErrorContains(t, err, `invalid Assets.FontAwesomeIntegrity "md5-abc"`)
+	assert.ErrorContains(t, err, `invalid CSP.Sources directive "Script Src"`)
+	assert.ErrorContains(t, err, `invalid CSP.Sources source "cdn.example.com; script-src *" for img-src`)
+
+	settings = Defaults()
+	settings.Database.Database = "prim"
+	assert.NoError(t, settings.Validate(), "Defaults with a database should be valid")
+}
+
+func TestRedacted(t *testing.T) {
+	settings := Defaults()
+	settings.Database.Password = "hunter2"
+	settings.Admin.Secret = "secret"
+
+	copied := settings.Redacted()
+	assert.Equal(t, "REDACTED", copied.Database.Password)
+	assert.Equal(t, "REDACTED", copied.Admin.Secret)
+	assert.Equal(t, "hunter2", settings.Database.Password, "Original should be unchanged")
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// the content a route can check with Index.CheckContent
+var routeContent = map[string]bool{
+	"thread": true,
+	"tag":    true,
+	"image":  true,
+}
+
+// the lists of posts a route can render for clients without javascript
+var routeNoscript = map[string]bool{
+	"thread": true,
+	"index":  true,
+}
+
+// reservedPaths are used by the other handlers
+var reservedPaths = []string{"/assets/", "/_admin", "/healthz", "/readyz", "/robots.txt", "/sitemap.xml", "/sitemap/", "/feed/", "/csp-report"}
+
+// Route is a page handled by the angularjs frontend
+type Route struct {
+	// Path is the gin route like /thread/:id/:page, the parameters have to be numbers
+	Path string
+	// Status is sent with the page, zero is 200
+	Status int `json:",omitempty"`
+	// Title is a template for the page title executed with RouteData, empty uses the imageboard title
+	Title string `json:",omitempty"`
+	// Description is a template for the meta description, empty uses the imageboard description
+	Description string `json:",omitempty"`
+	// Robots is the robots meta directive like "noindex, nofollow"
+	Robots string `json:",omitempty"`
+	// Content is the thread, tag or image in the id parameter checked by Index.CheckContent
+	Content string `json:",omitempty"`
+	// First is the path of the first page when the only parameter is a page number at the end
+	First string `json:",omitempty"`
+	// Noscript is the list rendered with Index.Noscript, the posts of the thread in :id
+	// on page :page with "thread", or the threads on page :id with "index"
+	Noscript string `json:",omitempty"`
+}
+
+// RouteData is what the title and description templates of a route are executed with
+type RouteData struct {
+	// Site and Desc are the imageboard title and description
+	Site string
+	Desc string
+	// Params are the route parameters
+	Params map[string]string
+	// Name is the thread title or tag name of the content, empty if it was not found
+	Name string
+	// Excerpt is the start of the first post of a thread or the post of an image
+	Excerpt string
+}
+
+// DefaultRoutes are the routes of the prim frontend
+func DefaultRoutes() []Route {
+	return []Route{
+		{Path: "/", Noscript: "index"},
+		{Path: "/page/:id", Title: "Page {{ .Params.id }} - {{ .Site }}", First: "/", Noscript: "index"},
+		{Path: "/thread/:id/:page", Content: "thread", Noscript: "thread",
+			Title:       `{{ or .Name (printf "Thread %s" .Params.id) }} - {{ .Site }}`,
+			Description: "{{ or .Excerpt .Desc }}"},
+		{Path: "/directory", Title: "Directory - {{ .Site }}"},
+		{Path: "/directory/:page", Title: "Directory - {{ .Site }}", First: "/directory"},
+		{Path: "/image/:id", Content: "image",
+			Title:       `{{ or .Name (printf "Image %s" .Params.id) }} - {{ .Site }}`,
+			Description: "{{ or .Excerpt .Desc }}"},
+		{Path: "/tags/:page", Title: "Tags - {{ .Site }}", First: "/tags"},
+		{Path: "/tags", Title: "Tags - {{ .Site }}"},
+		{Path: "/tag/:id/:page", Content: "tag",
+			Title:       "Tag: {{ or .Name .Params.id }} - {{ .Site }}",
+			Description: "Images tagged {{ or .Name .Params.id }} on {{ .Site }}"},
+		{Path: "/account", Title: "Account - {{ .Site }}", Robots: "noindex"},
+		{Path: "/trending", Title: "Trending - {{ .Site }}"},
+		{Path: "/favorites/:page", Title: "Favorites - {{ .Site }}", Robots: "noindex", First: "/favorites"},
+		{Path: "/favorites", Title: "Favorites - {{ .Site }}", Robots: "noindex"},
+		{Path: "/admin", Title: "Admin - {{ .Site }}", Robots: "noindex, nofollow"},
+		{Path: "/error", Status: http.StatusNotFound},
+	}
+}
+
+// ParseTitle parses the title template, it is nil when the route has no title
+func (r Route) ParseTitle() (*template.Template, error) {
+	return parseRouteTemplate(r.Path+" title", r.Title)
+}
+
+// ParseDescription parses the description template, it is nil when the route has no description
+func (r Route) ParseDescription() (*template.Template, error) {
+	return parseRouteTemplate(r.Path+" description", r.Description)
+}
+
+func parseRouteTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// Params returns the parameter names in the path
+func (r Route) Params() []string {
+	var params []string
+
+	for _, segment := range strings.Split(r.Path, "/") {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			params = append(params, name)
+		}
+	}
+
+	return params
+}
+
+// validateRoutes checks the route table
+func validateRoutes(routes []Route) []error {
+	var errs []error
+
+	if len(routes) == 0 {
+		errs = append(errs, errors.New("missing Routes"))
+	}
+
+	seen := make(map[string]bool)
+
+	for i, route := range routes {
+		name := fmt.Sprintf("Routes[%d]", i)
+
+		if err := validRoutePath(route.Path); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s.Path %q: %w", name, route.Path, err))
+			continue
+		}
+
+		if seen[route.Path] {
+			errs = append(errs, fmt.Errorf("duplicate %s.Path %q", name, route.Path))
+		}
+		seen[route.Path] = true
+
+		if route.Status != 0 && route.Status != http.StatusOK && (route.Status < http.StatusBadRequest || http.StatusText(route.Status) == "") {
+			errs = append(errs, fmt.Errorf("invalid %s.Status %d", name, route.Status))
+		}
+
+		params := route.Params()
+
+		if err := validTemplate(route.ParseTitle, params); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s.Title %q: %w", name, route.Title, err))
+		}
+
+		if err := validTemplate(route.ParseDescription, params); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s.Description %q: %w", name, route.Description, err))
+		}
+
+		if !validRobots(route.Robots) {
+			errs = append(errs, fmt.Errorf("invalid %s.Robots %q", name, route.Robots))
+		}
+
+		if route.Content != "" {
+			if !routeContent[route.Content] {
+				errs = append(errs, fmt.Errorf("invalid %s.Content %q", name, route.Content))
+			} else if !strings.Contains(route.Path, "/:id") {
+				errs = append(errs, fmt.Errorf("%s.Content needs an :id parameter in %q", name, route.Path))
+			}
+		}
+
+		if route.Noscript != "" {
+			if !routeNoscript[route.Noscript] {
+				errs = append(errs, fmt.Errorf("invalid %s.Noscript %q", name, route.Noscript))
+			} else if !validNoscriptParams(route.Noscript, params) {
+				errs = append(errs, fmt.Errorf("%s.Noscript %s does not match the parameters of %q", name, route.Noscript, route.Path))
+			}
+		}
+
+		if route.First != "" {
+			if !strings.HasPrefix(route.First, "/") {
+				errs = append(errs, fmt.Errorf("invalid %s.First %q", name, route.First))
+			}
+
+			// the pages are matched by the path before the page number
+			last := route.Path[strings.LastIndex(route.Path, "/")+1:]
+			if len(params) != 1 || !strings.HasPrefix(last, ":") {
+				errs = append(errs, fmt.Errorf("%s.First needs the only parameter at the end of %q", name, route.Path))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validNoscriptParams checks a route has the parameters its noscript list reads
+func validNoscriptParams(noscript string, params []string) bool {
+	has := make(map[string]bool)
+	for _, param := range params {
+		has[param] = true
+	}
+
+	switch noscript {
+	case "thread":
+		return has["id"] && has["page"]
+	case "index":
+		// the first page has no parameter
+		return len(params) == 0 || len(params) == 1 && has["id"]
+	}
+
+	return false
+}
+
+// validRoutePath checks a path only has static segments and named parameters
+func validRoutePath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.New("it has to start with /")
+	}
+
+	for _, reserved := range reservedPaths {
+		if path == strings.TrimSuffix(reserved, "/") || strings.HasPrefix(path, reserved) {
+			return fmt.Errorf("%s is reserved", reserved)
+		}
+	}
+
+	segments := strings.Split(path, "/")[1:]
+
+	for i, segment := range segments {
+		switch {
+		case segment == "" && path != "/":
+			return errors.New("empty segment")
+		case strings.HasPrefix(segment, "*"):
+			return errors.New("catch all parameters are not supported")
+		case strings.HasPrefix(segment, ":") && len(segment) == 1:
+			return errors.New("unnamed parameter")
+		case strings.ContainsAny(segment[min(1, len(segment)):], ":*?#"):
+			return fmt.Errorf("invalid segment %d", i+1)
+		}
+	}
+
+	return nil
+}
+
+// validTemplate parses a route template and runs it with sample parameters
+func validTemplate(parse func() (*template.Template, error), params []string) error {
+	t, err := parse()
+	if err != nil || t == nil {
+		return err
+	}
+
+	data := RouteData{Site: "Sample", Desc: "Sample imageboard", Params: make(map[string]string)}
+	for _, param := range params {
+		data.Params[param] = "1"
+	}
+
+	return t.Execute(io.Discard, data)
+}
+
+// validRobots checks the robots directives are comma separated words like noindex or max-snippet:50
+func validRobots(robots string) bool {
+	if robots == "" {
+		return true
+	}
+
+	for _, directive := range strings.Split(robots, ",") {
+		directive = strings.TrimSpace(directive)
+
+		if directive == "" {
+			return false
+		}
+
+		for _, r := range directive {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != ':' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRoutes(t *testing.T) {
+	assert.Empty(t, validateRoutes(DefaultRoutes()), "Default routes should be valid")
+}
+
+func TestLoadRoutes(t *testing.T) {
+	settings, err := Load(writeConfig(t, `{"Database":{"Database":"prim"}}`))
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, DefaultRoutes(), settings.Routes, "Routes should default to the frontend routes")
+
+	settings, err = Load(writeConfig(t, `{"Database":{"Database":"prim"},"Routes":[{"Path":"/"},{"Path":"/new/:id","Robots":"noindex"}]}`))
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, []Route{{Path: "/"}, {Path: "/new/:id", Robots: "noindex"}}, settings.Routes, "File should replace the whole route list")
+	assert.NoError(t, settings.Validate(), "Loaded routes should be valid")
+}
+
+func TestValidateRoutes(t *testing.T) {
+	for _, test := range []struct {
+		route Route
+		err   string
+	}{
+		{Route{Path: "page"}, "has to start with /"},
+		{Route{Path: "/page//1"}, "empty segment"},
+		{Route{Path: "/files/*path"}, "catch all"},
+		{Route{Path: "/page/:"}, "unnamed parameter"},
+		{Route{Path: "/feed/new"}, "reserved"},
+		{Route{Path: "/robots.txt"}, "reserved"},
+		{Route{Path: "/gone", Status: 302}, "invalid Routes[0].Status"},
+		{Route{Path: "/gone", Status: 499}, "invalid Routes[0].Status"},
+		{Route{Path: "/page/:id", Title: "{{ .Site"}, "invalid Routes[0].Title"},
+		{Route{Path: "/page/:id", Title: "{{ .Params.page }}"}, "invalid Routes[0].Title"},
+		{Route{Path: "/page/:id", Description: "{{ .Params.missing }}"}, "invalid Routes[0].Description"},
+		{Route{Path: "/page/:id", Robots: "noindex; nofollow"}, "invalid Routes[0].Robots"},
+		{Route{Path: "/page/:id", Content: "post"}, "invalid Routes[0].Content"},
+		{Route{Path: "/page/:page", Content: "thread"}, "needs an :id parameter"},
+		{Route{Path: "/page/:id", Noscript: "posts"}, "invalid Routes[0].Noscript"},
+		{Route{Path: "/thread/:id", Noscript: "thread"}, "does not match the parameters"},
+		{Route{Path: "/directory/:page", Noscript: "index"}, "does not match the parameters"},
+		{Route{Path: "/page", First: "/"}, "needs the only parameter"},
+		{Route{Path: "/thread/:id/:page", First: "/"}, "needs the only parameter"},
+		{Route{Path: "/page/:id", First: "page"}, "invalid Routes[0].First"},
+	} {
+		errs := validateRoutes([]Route{test.route})
+		if assert.Len(t, errs, 1, "Route should have one error: %+v", test.route) {
+			assert.Contains(t, errs[0].Error(), test.err, "Error should explain the problem: %+v", test.route)
+		}
+	}
+
+	errs := validateRoutes([]Route{{Path: "/gone", Status: 410, Title: "Gone - {{ .Site }}", Robots: "noindex, max-snippet:0"}})
+	assert.Empty(t, errs, "Error routes should be valid")
+
+	errs = validateRoutes([]Route{{Path: "/"}, {Path: "/"}})
+	assert.Len(t, errs, 1, "Duplicate paths should be an error")
+
+	settings := Defaults()
+	settings.Routes = nil
+	assert.ErrorContains(t, settings.Validate(), "missing Routes", "Routes should be required")
+}
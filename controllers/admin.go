@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+
+	m "github.com/eirka/eirka-index/middleware"
+)
+
+// AdminSitemapController reports the cached imageboard settings
+func AdminSitemapController(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"sites": m.SiteCache(),
+	})
+}
+
+// AdminPurgeController removes every imageboard from the cache
+func AdminPurgeController(c *gin.Context) {
+	shells.Purge()
+
+	c.JSON(http.StatusOK, gin.H{
+		"purged": m.PurgeSites(),
+	})
+}
+
+// AdminPurgeHostController removes one imageboard from the cache
+func AdminPurgeHostController(c *gin.Context) {
+	host := c.Param("host")
+
+	if !m.PurgeSite(host) {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	// the shells are keyed by their contents so the others are rendered again as well
+	shells.Purge()
+
+	c.JSON(http.StatusOK, gin.H{
+		"purged": 1,
+	})
+}
+
+// AdminReloadController reloads an imageboard from the database
+func AdminReloadController(c *gin.Context) {
+	host := c.Param("host")
+
+	site, err := m.ReloadSite(host)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		c.Error(err).SetMeta("AdminReloadController.ReloadSite")
+		return
+	} else if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("AdminReloadController.ReloadSite")
+		return
+	}
+
+	shells.Purge()
+
+	c.JSON(http.StatusOK, gin.H{
+		"host":  host,
+		"ib_id": site.Ib,
+		"title": site.Title,
+	})
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	m "github.com/eirka/eirka-index/middleware"
+)
+
+func setupAdminRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	admin := r.Group("/_admin")
+	admin.GET("/sitemap", AdminSitemapController)
+	admin.DELETE("/sitemap", AdminPurgeController)
+	admin.DELETE("/sitemap/:host", AdminPurgeHostController)
+	admin.POST("/sitemap/:host", AdminReloadController)
+
+	return r
+}
+
+func performAdminRequest(r http.Handler, method, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminSitemapControllers(t *testing.T) {
+	r := setupAdminRouter()
+
+	m.PurgeSites()
+	defer m.PurgeSites()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("test.board").
+		WillReturnRows(sqlmock.NewRows([]string{"ib_id", "ib_title", "ib_description", "ib_nsfw", "ib_api", "ib_img", "ib_style", "ib_logo", "ib_discord"}).
+			AddRow(1, "test board", "a test board", false, "api", "img", "style.css", "logo.png", ""))
+	mock.ExpectQuery(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != \?`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ib_title", "ib_domain"}))
+
+	// force a reload of the host
+	resp := performAdminRequest(r, "POST", "/_admin/sitemap/test.board")
+	assert.Equal(t, http.StatusOK, resp.Code, "Reload should succeed")
+	assert.Contains(t, resp.Body.String(), "test board", "Reload should return the new title")
+
+	// the host should now be reported
+	resp = performAdminRequest(r, "GET", "/_admin/sitemap")
+	assert.Equal(t, http.StatusOK, resp.Code, "Listing should succeed")
+
+	var listing struct {
+		Sites []m.SiteCacheEntry `json:"sites"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &listing), "Listing should be valid json")
+	if assert.Len(t, listing.Sites, 1, "One host should be cached") {
+		assert.Equal(t, "test.board", listing.Sites[0].Host)
+		assert.Equal(t, uint(1), listing.Sites[0].Ib)
+		assert.False(t, listing.Sites[0].Loaded.IsZero(), "Load time should be set")
+	}
+
+	// purge the host
+	resp = performAdminRequest(r, "DELETE", "/_admin/sitemap/test.board")
+	assert.Equal(t, http.StatusOK, resp.Code, "Purge should succeed")
+
+	resp = performAdminRequest(r, "DELETE", "/_admin/sitemap/test.board")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Purging an uncached host should 404")
+
+	resp = performAdminRequest(r, "DELETE", "/_admin/sitemap")
+	assert.Equal(t, http.StatusOK, resp.Code, "Purge all should succeed")
+	assert.Contains(t, resp.Body.String(), `"purged":0`, "Nothing should be left to purge")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestAdminReloadMissingHost(t *testing.T) {
+	r := setupAdminRouter()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("missing.board").
+		WillReturnRows(sqlmock.NewRows([]string{"ib_id"}))
+
+	resp := performAdminRequest(r, "POST", "/_admin/sitemap/missing.board")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Reloading an unknown host should 404")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
@@ -0,0 +1,9 @@
+package controllers
+
+import (
+	"github.com/eirka/eirka-index/assets"
+)
+
+// Prim has the digests of the files in the prim assets directory, without it
+// the pages link the files without integrity attributes
+var Prim *assets.Manifest
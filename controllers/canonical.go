@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+// pagedRoute is a route with a page number, its first page has its own url
+type pagedRoute struct {
+	// Prefix is the path before the page number
+	Prefix string
+	// First is the path of the first page
+	First string
+}
+
+// pagedRoutes are the routes in the route table that get pagination links
+func pagedRoutes() []pagedRoute {
+	var paged []pagedRoute
+
+	for _, route := range local.Settings.Routes {
+		if route.First == "" {
+			continue
+		}
+
+		paged = append(paged, pagedRoute{
+			Prefix: route.Path[:strings.LastIndex(route.Path, "/")+1],
+			First:  route.First,
+		})
+	}
+
+	return paged
+}
+
+// CanonicalRedirect sends a 301 to the canonical url for paths with a trailing
+// slash, the first page of a paged route and hosts with uppercase letters
+func CanonicalRedirect(c *gin.Context) {
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return
+	}
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	host := strings.ToLower(c.Request.Host)
+
+	path := canonicalPath(c.Request.URL.Path)
+
+	if host == c.Request.Host && path == c.Request.URL.Path {
+		return
+	}
+
+	location := absoluteURL(siteOrigin(c, host), "/"+site.Base+strings.TrimPrefix(path, "/"))
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+
+	c.Redirect(http.StatusMovedPermanently, location)
+	c.Abort()
+}
+
+// requestScheme returns the configured scheme, or the scheme the client used. The
+// X-Forwarded-Proto header is only taken from a proxy on a loopback or private address.
+func requestScheme(c *gin.Context) string {
+	if local.Settings.Index.Scheme != "" {
+		return local.Settings.Index.Scheme
+	}
+
+	if c.Request.TLS != nil {
+		return "https"
+	}
+
+	if proto := strings.ToLower(c.GetHeader("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		peer, err := netip.ParseAddr(c.RemoteIP())
+		if err == nil && (peer.IsLoopback() || peer.IsPrivate()) {
+			return proto
+		}
+	}
+
+	return "http"
+}
+
+// siteOrigin returns the scheme and host the links of a request are built with
+func siteOrigin(c *gin.Context, host string) string {
+	return requestScheme(c) + "://" + host
+}
+
+// canonicalPath removes trailing slashes, leading zeros of numbers and the page
+// number of a first page
+func canonicalPath(path string) string {
+	if path != "/" {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) > 1 && segment[0] == '0' && strings.Trim(segment, "0123456789") == "" {
+			// keep a zero so the page is still not found
+			segments[i] = strings.TrimLeft(segment, "0")
+			if segments[i] == "" {
+				segments[i] = "0"
+			}
+		}
+	}
+	path = strings.Join(segments, "/")
+
+	for _, route := range pagedRoutes() {
+		if path == route.Prefix+"1" {
+			return route.First
+		}
+	}
+
+	return path
+}
+
+// pageLinks returns the canonical url of a page and its previous and next pages
+func pageLinks(c *gin.Context, site *local.SiteData) (canonical, prev, next string) {
+	origin := siteOrigin(c, c.GetString("host"))
+
+	link := func(path string) string {
+		return absoluteURL(origin, "/"+site.Base+strings.TrimPrefix(path, "/"))
+	}
+
+	path := canonicalPath(c.Request.URL.Path)
+
+	canonical = link(path)
+
+	for _, route := range pagedRoutes() {
+		page := uint64(1)
+
+		if number, ok := strings.CutPrefix(path, route.Prefix); ok {
+			var err error
+
+			page, err = strconv.ParseUint(number, 10, 32)
+			if err != nil || page == 0 {
+				continue
+			}
+		} else if path != route.First {
+			continue
+		}
+
+		switch {
+		case page == 2:
+			prev = link(route.First)
+		case page > 2:
+			prev = link(fmt.Sprintf("%s%d", route.Prefix, page-1))
+		}
+
+		// the page count is only known to the api, the page keeps the next link
+		// only when the noscript list shows this is not the last page
+		next = link(fmt.Sprintf("%s%d", route.Prefix, page+1))
+
+		break
+	}
+
+	return
+}
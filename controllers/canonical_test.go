@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func setupCanonicalRouter(base string) *gin.Engine {
+	r := setupTemplateRouter()
+	r.RedirectTrailingSlash = false
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.Index.Scheme = "https"
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board", Base: base}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("host", strings.Split(c.Request.Host, ":")[0])
+		c.Set("sitemap", site)
+		c.Set("csrf_token", "test-csrf-token")
+	}, CanonicalRedirect)
+
+	r.GET("/", IndexController)
+	r.GET("/page/:id", IndexController)
+	r.GET("/directory", IndexController)
+	r.GET("/directory/:page", IndexController)
+	r.GET("/thread/:id/:page", IndexController)
+	r.NoRoute(ErrorController)
+
+	return r
+}
+
+func performHostRequest(r http.Handler, method, host, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Host = host
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCanonicalPath(t *testing.T) {
+	for path, canonical := range map[string]string{
+		"/":              "/",
+		"//":             "/",
+		"/page/1":        "/",
+		"/page/1/":       "/",
+		"/page/2/":       "/page/2",
+		"/directory/1":   "/directory",
+		"/directory/":    "/directory",
+		"/tags/1":        "/tags",
+		"/favorites/1":   "/favorites",
+		"/thread/1/1":    "/thread/1/1",
+		"/thread/10/1//": "/thread/10/1",
+		"/page/02":       "/page/2",
+		"/page/001":      "/",
+		"/thread/010/01": "/thread/10/1",
+		"/page/00":       "/page/0",
+		"/page/0":        "/page/0",
+		"/page/20":       "/page/20",
+	} {
+		assert.Equal(t, canonical, canonicalPath(path), "Canonical path of %s", path)
+	}
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	r := setupCanonicalRouter("")
+
+	for _, test := range []struct {
+		host, path, location string
+	}{
+		{"test.board", "/page/1", "https://test.board/"},
+		{"test.board", "/directory/", "https://test.board/directory"},
+		{"test.board", "/directory/1?sort=new", "https://test.board/directory?sort=new"},
+		{"test.board", "/thread/10/1/", "https://test.board/thread/10/1"},
+		{"test.board", "/page/02", "https://test.board/page/2"},
+		{"test.board", "/page/01", "https://test.board/"},
+		{"Test.Board", "/thread/10/1", "https://test.board/thread/10/1"},
+		{"TEST.board:8080", "/page/1/", "https://test.board:8080/"},
+		{"test.board", "/missing/", "https://test.board/missing"},
+	} {
+		resp := performHostRequest(r, "GET", test.host, test.path)
+		assert.Equal(t, http.StatusMovedPermanently, resp.Code, "Non canonical url should redirect: %s%s", test.host, test.path)
+		assert.Equal(t, test.location, resp.Header().Get("Location"), "Redirect should go to the canonical url: %s%s", test.host, test.path)
+	}
+
+	resp := performHostRequest(r, "GET", "test.board", "/page/2")
+	assert.Equal(t, http.StatusOK, resp.Code, "Canonical url should not redirect")
+
+	resp = performHostRequest(r, "POST", "test.board", "/page/1/")
+	assert.NotEqual(t, http.StatusMovedPermanently, resp.Code, "Only page requests should redirect")
+
+	// the base path of the imageboard is kept
+	r = setupCanonicalRouter("b/")
+
+	resp = performHostRequest(r, "GET", "test.board", "/page/1")
+	assert.Equal(t, "https://test.board/b/", resp.Header().Get("Location"), "Redirect should have the base path")
+}
+
+func TestCanonicalScheme(t *testing.T) {
+	r := setupCanonicalRouter("")
+	local.Settings.Index.Scheme = ""
+
+	for _, test := range []struct {
+		name, remote, proto, scheme string
+		tls                         bool
+	}{
+		{"plain http", "192.0.2.1:1234", "", "http", false},
+		{"tls", "192.0.2.1:1234", "", "https", true},
+		{"private proxy", "10.0.0.1:1234", "https", "https", false},
+		{"loopback proxy", "127.0.0.1:1234", "HTTPS", "https", false},
+		{"proxy over http", "10.0.0.1:1234", "http", "http", false},
+		{"untrusted proxy", "192.0.2.1:1234", "https", "http", false},
+		{"unknown proto", "10.0.0.1:1234", "gopher", "http", false},
+	} {
+		for path, link := range map[string]string{"/page/1": "/", "/page/2": "/page/2"} {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Host = "test.board"
+			req.RemoteAddr = test.remote
+			if test.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+			if test.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if path == "/page/1" {
+				assert.Equal(t, test.scheme+"://test.board"+link, w.Header().Get("Location"), "Redirect should use the request scheme: %s", test.name)
+			} else {
+				assert.Contains(t, w.Body.String(), `<link rel="canonical" href="`+test.scheme+"://test.board"+link+`" />`, "Canonical url should use the request scheme: %s", test.name)
+			}
+		}
+	}
+
+	// a configured scheme wins over the request
+	local.Settings.Index.Scheme = "https"
+
+	resp := performHostRequest(r, "GET", "test.board", "/page/1")
+	assert.Equal(t, "https://test.board/", resp.Header().Get("Location"), "Redirect should use the configured scheme")
+}
+
+func TestPageLinks(t *testing.T) {
+	r := setupCanonicalRouter("")
+
+	for _, test := range []struct {
+		path, canonical, prev string
+	}{
+		{"/", "https://test.board/", ""},
+		{"/page/2", "https://test.board/page/2", "https://test.board/"},
+		{"/page/5", "https://test.board/page/5", "https://test.board/page/4"},
+		{"/directory", "https://test.board/directory", ""},
+		{"/directory/3", "https://test.board/directory/3", "https://test.board/directory/2"},
+		{"/thread/10/2", "https://test.board/thread/10/2", ""},
+	} {
+		resp := performHostRequest(r, "GET", "test.board", test.path)
+		body := resp.Body.String()
+
+		assert.Contains(t, body, `<link rel="canonical" href="`+test.canonical+`" />`, "Page should have its canonical url: %s", test.path)
+
+		if test.prev != "" {
+			assert.Contains(t, body, `<link rel="prev" href="`+test.prev+`" />`, "Page should link the previous page: %s", test.path)
+		} else {
+			assert.NotContains(t, body, `rel="prev"`, "First page should not link a previous page: %s", test.path)
+		}
+
+		// without the noscript list the page count is unknown
+		assert.NotContains(t, body, `rel="next"`, "Page should not link a next page: %s", test.path)
+	}
+
+	resp := performHostRequest(r, "GET", "test.board", "/missing")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NotContains(t, resp.Body.String(), `rel="canonical"`, "Error page should not have a canonical url")
+}
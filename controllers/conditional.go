@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notModified sets the validators on the response and checks them against
+// the conditional request headers, returning true if a 304 was sent
+func notModified(c *gin.Context, etag string, modified time.Time) bool {
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if etag == "" || !etagMatch(match, etag) {
+			return false
+		}
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+
+	if since := c.GetHeader("If-Modified-Since"); since != "" && !modified.IsZero() {
+		t, err := http.ParseTime(since)
+		if err != nil || modified.Truncate(time.Second).After(t) {
+			return false
+		}
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// etagMatch compares an If-None-Match header with an etag using the weak comparison
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+// contents caches the page status of threads, tags and images
+var contents = cache.New[int](10000, time.Minute)
+
+// ValidateParams sends the 404 page when a route parameter is not a positive number
+func ValidateParams(c *gin.Context) {
+	for _, param := range c.Params {
+		if _, ok := paramID(param.Value); !ok {
+			ErrorPage(c, http.StatusNotFound)
+			return
+		}
+	}
+}
+
+// paramID parses an id or page number
+func paramID(value string) (uint, bool) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// contentStatus returns the page status for the content in the id parameter
+func contentStatus(c *gin.Context, site *local.SiteData, kind string) int {
+	id, ok := paramID(c.Param("id"))
+	if !ok {
+		return http.StatusNotFound
+	}
+
+	key := fmt.Sprintf("%s:%d:%d", kind, site.Ib, id)
+
+	if status, ok := contents.Get(key); ok {
+		return status
+	}
+
+	m := models.ContentModel{Ib: site.Ib, Kind: kind, ID: id}
+
+	status := http.StatusOK
+
+	err := m.Get()
+	if errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusNotFound
+	} else if err != nil {
+		// the frontend can still show the page, dont cache errors so the lookup is tried again
+		c.Error(err).SetMeta("contentStatus")
+		return http.StatusOK
+	} else if m.Deleted {
+		status = http.StatusGone
+	}
+
+	contents.Set(key, status)
+
+	return status
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+func setupContentRouter(check bool) *gin.Engine {
+	r := setupTemplateRouter()
+
+	contents.Purge()
+	summaries.Purge()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.Index.CheckContent = check
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board"}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("sitemap", site)
+		c.Set("csrf_token", "test-csrf-token")
+	})
+
+	thread, _ := RouteController(local.Route{Path: "/thread/:id/:page", Content: models.ContentThread})
+	tag, _ := RouteController(local.Route{Path: "/tag/:id/:page", Content: models.ContentTag})
+
+	r.GET("/page/:id", ValidateParams, IndexController)
+	r.GET("/thread/:id/:page", ValidateParams, thread)
+	r.GET("/tag/:id/:page", ValidateParams, tag)
+
+	return r
+}
+
+func TestValidateParams(t *testing.T) {
+	r := setupContentRouter(false)
+
+	for _, path := range []string{"/page/abc", "/page/0", "/page/-1", "/page/99999999999", "/thread/1/x", "/thread/x/1", "/tag/1.5/1"} {
+		resp := performCacheableRequest(r, path, "")
+		assert.Equal(t, http.StatusNotFound, resp.Code, "Invalid parameter should be not found: %s", path)
+		assert.Contains(t, resp.Body.String(), "code:'not_found'", "Invalid parameter should get the error page: %s", path)
+	}
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	// the summary lookup for the preview tags
+	mock.ExpectQuery(`SELECT thread_title`).WillReturnError(errors.New("no summary"))
+
+	for _, path := range []string{"/page/2", "/thread/10/1", "/tag/3/2"} {
+		resp := performCacheableRequest(r, path, "")
+		assert.Equal(t, http.StatusOK, resp.Code, "Valid parameters should get the page: %s", path)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Content should not be looked up without CheckContent")
+}
+
+func TestContentController(t *testing.T) {
+	r := setupContentRouter(true)
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery(`SELECT thread_title`).WillReturnError(errors.New("no summary"))
+	mock.ExpectQuery(`SELECT thread_deleted = 1 FROM threads`).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(false))
+
+	resp := performCacheableRequest(r, "/thread/10/1", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Existing thread should get the page")
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+
+	// the status is cached
+	resp = performCacheableRequest(r, "/thread/10/2", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Cached thread should get the page")
+
+	// deleted content is not looked up for the preview tags
+	mock.ExpectQuery(`SELECT thread_deleted = 1 FROM threads`).
+		WithArgs(11, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(true))
+
+	resp = performCacheableRequest(r, "/thread/11/1", "")
+	assert.Equal(t, http.StatusGone, resp.Code, "Deleted thread should be gone")
+	assert.Contains(t, resp.Body.String(), "code:'gone'", "Deleted thread should get the error page")
+
+	mock.ExpectQuery(`SELECT 0 FROM tags`).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted"}))
+
+	resp = performCacheableRequest(r, "/tag/3/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Missing tag should be not found")
+
+	mock.ExpectQuery(`SELECT 0 FROM tags`).
+		WithArgs(4, 1).
+		WillReturnError(errors.New("connection lost"))
+
+	resp = performCacheableRequest(r, "/tag/4/1", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Database errors should still get the page")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// MaxCSPReportSize is the largest violation report body that is read
+const MaxCSPReportSize = 64 << 10
+
+// CSPLogLimit is how many violations are logged a minute, the rest are only counted
+const CSPLogLimit = 60
+
+// MaxCSPLogLength is how much of a reported uri is logged
+const MaxCSPLogLength = 200
+
+// DiscordCDN serves the avatars shown in the discord widget
+const DiscordCDN = "https://cdn.discordapp.com"
+
+// cspDirectives is the order the directives are sent in
+var cspDirectives = []string{
+	"default-src",
+	"script-src",
+	"style-src",
+	"img-src",
+	"font-src",
+	"connect-src",
+	"frame-src",
+	"object-src",
+	"base-uri",
+}
+
+// contentSecurityPolicy sets the policy header for a page and returns the nonce
+// for its scripts, the nonce is empty when the policy is disabled
+func contentSecurityPolicy(c *gin.Context, site *local.SiteData) string {
+	if !local.Settings.CSP.Enabled {
+		return ""
+	}
+
+	nonce := rand.Text()
+
+	setContentSecurityPolicy(c, site, fmt.Sprintf("'nonce-%s'", nonce))
+
+	return nonce
+}
+
+// setContentSecurityPolicy sets the policy header allowing the given script sources
+func setContentSecurityPolicy(c *gin.Context, site *local.SiteData, scripts ...string) {
+	settings := local.Settings
+
+	header := "Content-Security-Policy"
+	if settings.CSP.ReportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+
+	// added so the frame-ancestors policy from the security headers is kept
+	c.Writer.Header().Add(header, cspPolicy(site, settings, scripts...))
+}
+
+// cspPolicy builds the policy allowing the imageboard api and image servers and
+// the inline scripts matching the nonce or hashes in scripts
+func cspPolicy(site *local.SiteData, settings *local.Config, scripts ...string) string {
+	directives := map[string][]string{
+		"default-src": {"'self'"},
+		"script-src":  append([]string{"'self'"}, scripts...),
+		// angularjs sets inline styles
+		"style-src":   {"'self'", "'unsafe-inline'"},
+		"img-src":     {"'self'", "data:"},
+		"font-src":    {"'self'"},
+		"connect-src": {"'self'"},
+		"object-src":  {"'none'"},
+		"base-uri":    {"'self'"},
+	}
+
+	// the font-awesome stylesheet and fonts from its cdn
+	if cdn := origin(settings.Assets.FontAwesome); cdn != "" {
+		directives["style-src"] = append(directives["style-src"], cdn)
+		directives["font-src"] = append(directives["font-src"], cdn)
+	}
+
+	if site.Img != "" {
+		directives["img-src"] = append(directives["img-src"], site.Img)
+	}
+
+	if site.API != "" {
+		directives["connect-src"] = append(directives["connect-src"], site.API)
+	}
+
+	// the frontend fetches the discord widget json and shows the member avatars
+	if widget := origin(site.Discord); widget != "" {
+		directives["connect-src"] = append(directives["connect-src"], widget)
+		directives["img-src"] = append(directives["img-src"], DiscordCDN)
+	}
+
+	// directives only set in the config go at the end
+	var extra []string
+	for directive := range settings.CSP.Sources {
+		if _, ok := directives[directive]; !ok {
+			extra = append(extra, directive)
+		}
+	}
+	sort.Strings(extra)
+
+	order := append(slices.Clone(cspDirectives), extra...)
+
+	for directive, sources := range settings.CSP.Sources {
+		directives[directive] = append(directives[directive], sources...)
+	}
+
+	var policy []string
+
+	for _, directive := range order {
+		sources, ok := directives[directive]
+		if !ok {
+			continue
+		}
+
+		policy = append(policy, strings.TrimSpace(directive+" "+strings.Join(sources, " ")))
+	}
+
+	report := settings.CSP.ReportURI
+	if report == "" {
+		report = fmt.Sprintf("/%scsp-report", site.Base)
+	}
+
+	policy = append(policy, "report-uri "+report)
+
+	return strings.Join(policy, "; ")
+}
+
+// origin returns the scheme and host of an absolute url
+func origin(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+}
+
+// cspViolation is the part of a violation report that is logged
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+}
+
+// reportingViolation is a violation sent through the Reporting API
+type reportingViolation struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+	} `json:"body"`
+}
+
+// CSPReportController collects the violation reports sent by browsers
+func CSPReportController(c *gin.Context) {
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxCSPReportSize))
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInvalidParam))
+		c.Error(err).SetMeta("CSPReportController.ReadAll")
+		return
+	}
+
+	violations, err := parseCSPReport(body)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInvalidParam))
+		c.Error(err).SetMeta("CSPReportController.parseCSPReport")
+		return
+	}
+
+	for _, violation := range violations {
+		directive := violation.EffectiveDirective
+		if directive == "" {
+			// older browsers only send the whole violated directive
+			directive, _, _ = strings.Cut(violation.ViolatedDirective, " ")
+		}
+
+		// the reports are from anyone so only known directives get their own series
+		directive = reportedDirective(directive)
+
+		metrics.CSPReports.WithLabelValues(directive).Inc()
+
+		if cspLogAllowed() {
+			log.Printf("CSP: %s blocked %q on %q (%s)", directive, trimReport(violation.BlockedURI), trimReport(violation.DocumentURI), c.GetString("host"))
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+
+}
+
+// reportedDirective maps a reported directive to one the policy sends, the element
+// and attribute directives are counted with the directive they fall back to
+func reportedDirective(directive string) string {
+	directive = strings.TrimSuffix(strings.TrimSuffix(directive, "-elem"), "-attr")
+
+	if directive == "frame-ancestors" || slices.Contains(cspDirectives, directive) {
+		return directive
+	}
+
+	return "other"
+}
+
+// trimReport shortens a reported value for the log
+func trimReport(value string) string {
+	if len(value) > MaxCSPLogLength {
+		return value[:MaxCSPLogLength] + "..."
+	}
+	return value
+}
+
+// cspLog counts the violations logged in the current minute
+var cspLog struct {
+	sync.Mutex
+	window time.Time
+	count  int
+}
+
+// cspLogAllowed reports if a violation can be logged within CSPLogLimit
+func cspLogAllowed() bool {
+	cspLog.Lock()
+	defer cspLog.Unlock()
+
+	if now := time.Now(); now.Sub(cspLog.window) >= time.Minute {
+		cspLog.window = now
+		cspLog.count = 0
+	}
+
+	if cspLog.count >= CSPLogLimit {
+		return false
+	}
+
+	cspLog.count++
+
+	return true
+}
+
+// parseCSPReport reads the report-uri and the Reporting API formats
+func parseCSPReport(body []byte) ([]cspViolation, error) {
+	var report struct {
+		Report *cspViolation `json:"csp-report"`
+	}
+
+	if err := json.Unmarshal(body, &report); err == nil {
+		if report.Report == nil {
+			return nil, errors.New("missing csp-report")
+		}
+		return []cspViolation{*report.Report}, nil
+	}
+
+	var reports []reportingViolation
+
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil, err
+	}
+
+	var violations []cspViolation
+
+	for _, report := range reports {
+		if report.Type != "csp-violation" {
+			continue
+		}
+
+		violations = append(violations, cspViolation{
+			DocumentURI:        report.Body.DocumentURL,
+			BlockedURI:         report.Body.BlockedURL,
+			EffectiveDirective: report.Body.EffectiveDirective,
+		})
+	}
+
+	return violations, nil
+}
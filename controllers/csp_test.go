@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eirka/eirka-libs/config"
+
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/metrics"
+)
+
+func TestCSPPolicy(t *testing.T) {
+	site := &local.SiteData{
+		Ib:      1,
+		API:     "api.test.com",
+		Img:     "img.test.com",
+		Discord: "https://discord.com/widget?id=1234",
+	}
+
+	settings := &local.Config{
+		CSP: local.CSP{
+			Sources: map[string][]string{
+				"script-src": {"https://analytics.test.com"},
+				"worker-src": {"'self'"},
+			},
+		},
+		Assets: local.Assets{
+			FontAwesome: "https://maxcdn.bootstrapcdn.com/font-awesome/4.4.0/css/font-awesome.min.css",
+		},
+	}
+
+	assert.Equal(t, "default-src 'self'; "+
+		"script-src 'self' 'nonce-abc' https://analytics.test.com; "+
+		"style-src 'self' 'unsafe-inline' https://maxcdn.bootstrapcdn.com; "+
+		"img-src 'self' data: img.test.com https://cdn.discordapp.com; "+
+		"font-src 'self' https://maxcdn.bootstrapcdn.com; "+
+		"connect-src 'self' api.test.com https://discord.com; "+
+		"object-src 'none'; "+
+		"base-uri 'self'; "+
+		"worker-src 'self'; "+
+		"report-uri /csp-report", cspPolicy(site, settings, "'nonce-abc'"))
+
+	settings = &local.Config{CSP: local.CSP{ReportURI: "https://reports.test.com/csp"}}
+
+	policy := cspPolicy(&local.SiteData{Ib: 1, Base: "b/"}, settings, "'nonce-abc'")
+	assert.NotContains(t, policy, "discord", "Boards without discord should not allow its origins")
+	assert.NotContains(t, policy, "frame-src", "Pages should not allow frames")
+	assert.Contains(t, policy, "font-src 'self';", "Only local fonts should be allowed without font-awesome")
+	assert.True(t, strings.HasSuffix(policy, "; report-uri https://reports.test.com/csp"), "Configured report uri should be used")
+}
+
+func TestIndexControllerCSP(t *testing.T) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	r.GET("/", func(c *gin.Context) {
+		c.Set("sitemap", &local.SiteData{Ib: 1, API: "api.test.com", Img: "img.test.com", Title: "Test Board"})
+		c.Set("csrf_token", "test-csrf-token")
+		IndexController(c)
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	local.Settings = &local.Config{}
+
+	w := request()
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"), "Policy should not be sent when disabled")
+	assert.NotContains(t, w.Body.String(), "nonce=", "Scripts should not have a nonce when disabled")
+
+	local.Settings = &local.Config{CSP: local.CSP{Enabled: true}}
+
+	w = request()
+	policy := w.Header().Get("Content-Security-Policy")
+	assert.Contains(t, policy, "connect-src 'self' api.test.com", "Policy should allow the api server")
+
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(policy)
+	if assert.Len(t, nonce, 2, "Policy should have a nonce") {
+		assert.Equal(t, 2, strings.Count(w.Body.String(), `nonce="`+nonce[1]+`"`), "Bundle and inline config scripts should have the nonce")
+	}
+
+	second := request().Header().Get("Content-Security-Policy")
+	assert.NotEqual(t, policy, second, "Every request should get a new nonce")
+
+	local.Settings.CSP.ReportOnly = true
+
+	w = request()
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"), "Report only should not enforce the policy")
+	assert.NotEmpty(t, w.Header().Get("Content-Security-Policy-Report-Only"), "Report only header should be sent")
+}
+
+func performCSPReport(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.POST("/csp-report", CSPReportController)
+
+	req, _ := http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/csp-report")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCSPReportController(t *testing.T) {
+	before := testutil.ToFloat64(metrics.CSPReports.WithLabelValues("script-src"))
+
+	resp := performCSPReport(`{"csp-report":{"document-uri":"https://test.board/","blocked-uri":"inline","violated-directive":"script-src-elem 'self'","effective-directive":"script-src-elem"}}`)
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Report should be accepted")
+
+	resp = performCSPReport(`[{"type":"csp-violation","body":{"documentURL":"https://test.board/","blockedURL":"inline","effectiveDirective":"script-src-elem"}},{"type":"deprecation","body":{}}]`)
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Reporting API report should be accepted")
+
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.CSPReports.WithLabelValues("script-src")), "Violations should be counted by the directive they fall back to")
+
+	resp = performCSPReport(`{"csp-report":{"document-uri":"https://test.board/","violated-directive":"img-src 'self'"}}`)
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Old report should be accepted")
+	assert.NotZero(t, testutil.ToFloat64(metrics.CSPReports.WithLabelValues("img-src")), "Violated directive should be used without an effective directive")
+
+	other := testutil.ToFloat64(metrics.CSPReports.WithLabelValues("other"))
+	series := testutil.CollectAndCount(metrics.CSPReports)
+
+	resp = performCSPReport(`{"csp-report":{"document-uri":"https://test.board/\nforged log line","effective-directive":"made-up-directive-1234"}}`)
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Unknown directive should be accepted")
+	assert.Equal(t, other+1, testutil.ToFloat64(metrics.CSPReports.WithLabelValues("other")), "Unknown directives should be counted as other")
+	assert.Equal(t, series, testutil.CollectAndCount(metrics.CSPReports), "Unknown directives should not add series")
+
+	resp = performCSPReport(`not json`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Invalid report should be rejected")
+
+	resp = performCSPReport(`{}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Report without a violation should be rejected")
+
+	resp = performCSPReport(`{"csp-report":{"blocked-uri":"` + strings.Repeat("a", MaxCSPReportSize) + `"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "Large report should be rejected")
+}
+
+func TestReportedDirective(t *testing.T) {
+	assert.Equal(t, "script-src", reportedDirective("script-src-elem"))
+	assert.Equal(t, "style-src", reportedDirective("style-src-attr"))
+	assert.Equal(t, "frame-ancestors", reportedDirective("frame-ancestors"))
+	assert.Equal(t, "img-src", reportedDirective("img-src"))
+	assert.Equal(t, "other", reportedDirective(""))
+	assert.Equal(t, "other", reportedDirective("img-src\nforged"))
+
+	assert.Equal(t, strings.Repeat("a", MaxCSPLogLength)+"...", trimReport(strings.Repeat("a", MaxCSPLogLength+10)), "Long values should be trimmed")
+	assert.Equal(t, "short", trimReport("short"))
+}
+
+func TestCSPLogLimit(t *testing.T) {
+	cspLog.Lock()
+	cspLog.window = time.Time{}
+	cspLog.Unlock()
+
+	for i := 0; i < CSPLogLimit; i++ {
+		assert.True(t, cspLogAllowed(), "Violations under the limit should be logged")
+	}
+
+	assert.False(t, cspLogAllowed(), "Violations over the limit should not be logged")
+
+	// the next minute logs again
+	cspLog.Lock()
+	cspLog.window = time.Now().Add(-time.Minute)
+	cspLog.Unlock()
+
+	assert.True(t, cspLogAllowed(), "Violations should be logged in the next minute")
+}
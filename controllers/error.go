@@ -2,45 +2,24 @@ package controllers
 
 import (
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
 
-	"github.com/eirka/eirka-libs/config"
 	"github.com/gin-gonic/gin"
-
-	local "github.com/eirka/eirka-index/config"
 )
 
 // ErrorController generates pages and a 404 response
 func ErrorController(c *gin.Context) {
+	page(c, http.StatusNotFound, pageMeta{})
+}
 
-	// get sitemap from session middleware
-	site := c.MustGet("sitemap").(*local.SiteData)
-
-	var discord string
-
-	// add a cache breaker because their thing is dumb
-	if site.Discord != "" {
-		nonce := strconv.FormatUint(uint64(site.Ib), 10) + strconv.FormatInt(time.Now().Unix(), 10)
-		discord = strings.Join([]string{site.Discord, nonce}, "?")
+// StatusController generates pages with an error status like 410, 451 or 503
+func StatusController(status int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page(c, status, pageMeta{})
 	}
+}
 
-	c.HTML(http.StatusNotFound, "index", gin.H{
-		"primjs":      config.Settings.Prim.JS,
-		"primcss":     config.Settings.Prim.CSS,
-		"ib":          site.Ib,
-		"base":        site.Base,
-		"apisrv":      site.API,
-		"imgsrv":      site.Img,
-		"title":       site.Title,
-		"desc":        site.Desc,
-		"nsfw":        site.Nsfw,
-		"style":       site.Style,
-		"logo":        site.Logo,
-		"discord":     discord,
-		"imageboards": site.Imageboards,
-		"csrf":        c.MustGet("csrf_token").(string),
-	})
-
+// ErrorPage stops the request with the error page for a status
+func ErrorPage(c *gin.Context, status int) {
+	c.Abort()
+	page(c, status, pageMeta{})
 }
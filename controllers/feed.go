@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+// FeedLimit is the amount of entries in a feed
+const FeedLimit = 30
+
+// the feed formats
+const (
+	feedAtom = "atom"
+	feedRSS  = "rss"
+)
+
+// feeds caches the rendered feeds by imageboard and path
+var feeds = cache.New[*renderedFeed](500, 5*time.Minute)
+
+// renderedFeed is a feed ready to send
+type renderedFeed struct {
+	body     []byte
+	etag     string
+	modified time.Time
+}
+
+// feed is the format independent content of a feed
+type feed struct {
+	Title string
+	Desc  string
+	// Author is the imageboard, atom feeds need one
+	Author  string
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []feedEntry
+}
+
+type feedEntry struct {
+	Title     string
+	Link      string
+	Summary   string
+	Thumbnail string
+	Updated   time.Time
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Summary string     `xml:"summary,omitempty"`
+	Links   []atomLink `xml:"link"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        string        `xml:"guid"`
+	Description string        `xml:"description,omitempty"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// ThreadFeedController generates a feed of the latest threads
+func ThreadFeedController(c *gin.Context) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	format := feedFormat(c.Request.URL.Path)
+	if format == "" {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	key := fmt.Sprintf("%d:threads:%s:%s", site.Ib, format, requestScheme(c))
+
+	if rendered, ok := feeds.Get(key); ok {
+		sendFeed(c, format, rendered)
+		return
+	}
+
+	m := models.ThreadFeedModel{Ib: site.Ib, Limit: FeedLimit}
+
+	err := m.Get()
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("ThreadFeedController.Get")
+		return
+	}
+
+	origin := siteOrigin(c, c.GetString("host"))
+
+	f := feed{
+		Title:  site.Title,
+		Desc:   site.Desc,
+		Author: site.Title,
+		Link:   absoluteURL(origin, "/"+site.Base),
+		Self:   absoluteURL(origin, c.Request.URL.Path),
+	}
+
+	for _, item := range m.Result {
+		f.Entries = append(f.Entries, feedEntry{
+			Title:     item.Title,
+			Link:      absoluteURL(origin, fmt.Sprintf("/%sthread/%d/1", site.Base, item.ID)),
+			Summary:   item.Excerpt,
+			Thumbnail: feedThumbnail(site, item.Thumbnail),
+			Updated:   item.Updated,
+		})
+	}
+
+	rendered, err := renderFeed(format, f)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("ThreadFeedController.renderFeed")
+		return
+	}
+
+	feeds.Set(key, rendered)
+
+	sendFeed(c, format, rendered)
+
+}
+
+// TagFeedController generates a feed of the latest images in a tag
+func TagFeedController(c *gin.Context) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	format := feedFormat(c.Param("id"))
+
+	id, err := strconv.ParseUint(strings.TrimSuffix(c.Param("id"), "."+format), 10, 32)
+	if format == "" || err != nil || id == 0 {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	key := fmt.Sprintf("%d:tag:%d:%s:%s", site.Ib, id, format, requestScheme(c))
+
+	if rendered, ok := feeds.Get(key); ok {
+		sendFeed(c, format, rendered)
+		return
+	}
+
+	m := models.TagFeedModel{Ib: site.Ib, Tag: uint(id), Limit: FeedLimit}
+
+	err = m.Get()
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	} else if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("TagFeedController.Get")
+		return
+	}
+
+	origin := siteOrigin(c, c.GetString("host"))
+
+	f := feed{
+		Title:  fmt.Sprintf("%s - %s", m.Name, site.Title),
+		Desc:   site.Desc,
+		Author: site.Title,
+		Link:   absoluteURL(origin, fmt.Sprintf("/%stag/%d/1", site.Base, id)),
+		Self:   absoluteURL(origin, c.Request.URL.Path),
+	}
+
+	for _, item := range m.Result {
+		f.Entries = append(f.Entries, feedEntry{
+			Title:     item.Title,
+			Link:      absoluteURL(origin, fmt.Sprintf("/%simage/%d", site.Base, item.ID)),
+			Summary:   item.Excerpt,
+			Thumbnail: feedThumbnail(site, item.Thumbnail),
+			Updated:   item.Updated,
+		})
+	}
+
+	rendered, err := renderFeed(format, f)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("TagFeedController.renderFeed")
+		return
+	}
+
+	feeds.Set(key, rendered)
+
+	sendFeed(c, format, rendered)
+
+}
+
+// feedFormat returns the format from the file extension
+func feedFormat(name string) string {
+	switch path.Ext(name) {
+	case ".atom":
+		return feedAtom
+	case ".rss":
+		return feedRSS
+	}
+	return ""
+}
+
+// feedThumbnail returns the url of a thumbnail on the image server
+func feedThumbnail(site *local.SiteData, thumbnail string) string {
+	if thumbnail == "" {
+		return ""
+	}
+	return absoluteURL(site.Img, "/thumb/"+thumbnail)
+}
+
+// sendFeed writes the feed unless the client already has it
+func sendFeed(c *gin.Context, format string, rendered *renderedFeed) {
+	c.Header("Cache-Control", "public, max-age=300")
+
+	if notModified(c, rendered.etag, rendered.modified) {
+		return
+	}
+
+	contentType := "application/atom+xml; charset=utf-8"
+	if format == feedRSS {
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+
+	c.Data(http.StatusOK, contentType, rendered.body)
+}
+
+// renderFeed encodes the feed in the requested format
+func renderFeed(format string, f feed) (*renderedFeed, error) {
+
+	// the feed was updated when its newest entry was
+	for _, entry := range f.Entries {
+		if entry.Updated.After(f.Updated) {
+			f.Updated = entry.Updated
+		}
+	}
+
+	if f.Updated.IsZero() {
+		f.Updated = time.Now()
+	}
+
+	var v interface{}
+
+	switch format {
+	case feedAtom:
+		v = atomDocument(f)
+	case feedRSS:
+		v = rssDocument(f)
+	default:
+		return nil, fmt.Errorf("unknown feed format %s", format)
+	}
+
+	body, err := marshalXML(v)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+
+	return &renderedFeed{
+		body:     body,
+		etag:     `"` + hex.EncodeToString(sum[:16]) + `"`,
+		modified: f.Updated,
+	}, nil
+}
+
+func atomDocument(f feed) atomFeed {
+	doc := atomFeed{
+		ID:       f.Self,
+		Title:    f.Title,
+		Subtitle: f.Desc,
+		Updated:  f.Updated.UTC().Format(time.RFC3339),
+		// the entries inherit the feed author
+		Author: atomAuthor{Name: f.Author},
+		Links: []atomLink{
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+		},
+	}
+
+	for _, entry := range f.Entries {
+		item := atomEntry{
+			ID:      entry.Link,
+			Title:   entry.Title,
+			Updated: entry.Updated.UTC().Format(time.RFC3339),
+			Summary: entry.Summary,
+			Links:   []atomLink{{Rel: "alternate", Type: "text/html", Href: entry.Link}},
+		}
+
+		if entry.Thumbnail != "" {
+			item.Links = append(item.Links, atomLink{Rel: "enclosure", Type: thumbnailType(entry.Thumbnail), Href: entry.Thumbnail})
+		}
+
+		doc.Entries = append(doc.Entries, item)
+	}
+
+	return doc
+}
+
+func rssDocument(f feed) rssFeed {
+	doc := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Desc,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomLink{Rel: "self", Type: "application/rss+xml", Href: f.Self},
+		},
+	}
+
+	for _, entry := range f.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        entry.Link,
+			Description: entry.Summary,
+			PubDate:     entry.Updated.UTC().Format(time.RFC1123Z),
+		}
+
+		if entry.Thumbnail != "" {
+			// the size of the thumbnail is not known so the length is zero
+			item.Enclosure = &rssEnclosure{URL: entry.Thumbnail, Length: "0", Type: thumbnailType(entry.Thumbnail)}
+		}
+
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return doc
+}
+
+// thumbnailType guesses the mime type of a thumbnail from its name
+func thumbnailType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "image/jpeg"
+}
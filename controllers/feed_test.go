@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func setupFeedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	feeds.Purge()
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board", Desc: "A test imageboard", Img: "img.test.com"}
+
+	setup := func(c *gin.Context) {
+		c.Set("host", "test.board")
+		c.Set("sitemap", site)
+	}
+
+	r.GET("/feed/threads.atom", setup, ThreadFeedController)
+	r.GET("/feed/threads.rss", setup, ThreadFeedController)
+	r.GET("/feed/tag/:id", setup, TagFeedController)
+
+	return r
+}
+
+func performFeedRequest(r http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func expectThreadFeed(mock sqlmock.Sqlmock, updated time.Time) {
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\),thread_last_post FROM threads`).
+		WithArgs(1, FeedLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_id", "thread_title", "post_text", "image_thumbnail", "thread_last_post"}).
+			AddRow(10, "Cool Thread", "the first post", "123s.png", updated).
+			AddRow(9, "Old Thread", "", "", updated.Add(-time.Hour)))
+}
+
+func TestThreadFeedAtom(t *testing.T) {
+	r := setupFeedRouter()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	expectThreadFeed(mock, updated)
+
+	resp := performFeedRequest(r, "/feed/threads.atom", nil)
+
+	body := resp.Body.String()
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "Thu, 02 Jan 2020 03:04:05 GMT", resp.Header().Get("Last-Modified"))
+	assert.NotEmpty(t, resp.Header().Get("ETag"))
+
+	var doc atomFeed
+	assert.NoError(t, xml.Unmarshal(resp.Body.Bytes(), &doc), "Feed should be valid xml")
+	assert.Equal(t, "Test Board", doc.Title)
+	assert.Equal(t, "2020-01-02T03:04:05Z", doc.Updated, "Feed should be updated with its newest entry")
+	assert.Equal(t, "Test Board", doc.Author.Name, "Feed should have the imageboard as its author")
+	assert.Contains(t, body, `<author><name>Test Board</name></author>`)
+	if assert.Len(t, doc.Entries, 2) {
+		assert.Equal(t, "http://test.board/thread/10/1", doc.Entries[0].ID)
+		assert.Equal(t, "the first post", doc.Entries[0].Summary)
+	}
+	assert.Contains(t, body, `<link rel="enclosure" type="image/png" href="https://img.test.com/thumb/123s.png"></link>`)
+
+	// conditional requests should not send the body again
+	resp2 := performFeedRequest(r, "/feed/threads.atom", map[string]string{"If-None-Match": resp.Header().Get("ETag")})
+	assert.Equal(t, http.StatusNotModified, resp2.Code, "Matching etag should return 304")
+	assert.Empty(t, resp2.Body.String())
+
+	resp3 := performFeedRequest(r, "/feed/threads.atom", map[string]string{"If-Modified-Since": "Thu, 02 Jan 2020 03:04:05 GMT"})
+	assert.Equal(t, http.StatusNotModified, resp3.Code, "Unmodified feed should return 304")
+
+	resp4 := performFeedRequest(r, "/feed/threads.atom", map[string]string{"If-Modified-Since": "Thu, 02 Jan 2020 03:04:04 GMT"})
+	assert.Equal(t, http.StatusOK, resp4.Code, "Modified feed should be sent")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestThreadFeedRSS(t *testing.T) {
+	r := setupFeedRouter()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	expectThreadFeed(mock, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	resp := performFeedRequest(r, "/feed/threads.rss", nil)
+
+	body := resp.Body.String()
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/rss+xml; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(t, body, `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">`)
+	assert.Contains(t, body, `<atom:link rel="self" type="application/rss+xml" href="http://test.board/feed/threads.rss"></atom:link>`)
+	assert.Contains(t, body, `<pubDate>Thu, 02 Jan 2020 03:04:05 +0000</pubDate>`)
+	assert.Contains(t, body, `<enclosure url="https://img.test.com/thumb/123s.png" length="0" type="image/png"></enclosure>`)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestTagFeed(t *testing.T) {
+	r := setupFeedRouter()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT tag_name FROM tags WHERE tag_id = \? AND ib_id = \?`).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"tag_name"}).AddRow("cats"))
+	mock.ExpectQuery(`SELECT images.image_id,thread_title,COALESCE\(post_text,''\),image_thumbnail,post_time FROM tagmap`).
+		WithArgs(5, 1, FeedLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "thread_title", "post_text", "image_thumbnail", "post_time"}).
+			AddRow(77, "Cat Thread", "a cat", "77s.jpg", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	resp := performFeedRequest(r, "/feed/tag/5.atom", nil)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "<title>cats - Test Board</title>")
+	assert.Contains(t, resp.Body.String(), "<author><name>Test Board</name></author>", "Tag feeds should have the imageboard as their author")
+	assert.Contains(t, resp.Body.String(), "<id>http://test.board/image/77</id>")
+
+	mock.ExpectQuery(`SELECT tag_name FROM tags WHERE tag_id = \? AND ib_id = \?`).
+		WithArgs(6, 1).
+		WillReturnError(sqlmock.ErrCancelled)
+
+	resp = performFeedRequest(r, "/feed/tag/6.rss", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+
+	resp = performFeedRequest(r, "/feed/tag/5.json", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Unknown formats should 404")
+
+	resp = performFeedRequest(r, "/feed/tag/cats.atom", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Invalid ids should 404")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-libs/db"
+)
+
+// Health holds the state probed by the health endpoints
+type Health struct {
+	// Templates reports if the template set is parsed
+	Templates func() bool
+	// IncludesDir is the directory with the template includes
+	IncludesDir string
+
+	draining atomic.Bool
+}
+
+// Drain marks the service as not ready so the load balancer stops sending traffic
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// LivenessController reports that the process is running
+func (h *Health) LivenessController(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+// ReadinessController reports if the service can handle requests
+func (h *Health) ReadinessController(c *gin.Context) {
+	checks := gin.H{}
+	ready := true
+
+	check := func(name string, ok bool, failure string) {
+		if ok {
+			checks[name] = "ok"
+			return
+		}
+		checks[name] = failure
+		ready = false
+	}
+
+	check("shutdown", !h.draining.Load(), "draining")
+	check("database", db.Ping(), "unreachable")
+	check("templates", h.Templates != nil && h.Templates(), "not parsed")
+
+	_, err := os.ReadDir(h.IncludesDir)
+	check("includes", err == nil, "unreadable")
+
+	status := http.StatusOK
+	message := "ready"
+
+	if !ready {
+		status = http.StatusServiceUnavailable
+		message = "not ready"
+	}
+
+	c.JSON(status, gin.H{
+		"status": message,
+		"checks": checks,
+	})
+}
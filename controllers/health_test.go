@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func performReadinessRequest(h *Health) (int, readiness) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/healthz", h.LivenessController)
+	r.GET("/readyz", h.ReadinessController)
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body readiness
+	json.Unmarshal(w.Body.Bytes(), &body)
+
+	return w.Code, body
+}
+
+func TestLiveness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/healthz", (&Health{}).LivenessController)
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	h := &Health{
+		Templates:   func() bool { return true },
+		IncludesDir: t.TempDir(),
+	}
+
+	code, body := performReadinessRequest(h)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body.Status)
+	assert.Equal(t, map[string]string{"shutdown": "ok", "database": "ok", "templates": "ok", "includes": "ok"}, body.Checks)
+
+	// the service stops being ready when it shuts down
+	h.Drain()
+
+	code, body = performReadinessRequest(h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", body.Status)
+	assert.Equal(t, "draining", body.Checks["shutdown"])
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestReadinessFailures(t *testing.T) {
+	_, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+
+	// a closed database cant be pinged
+	db.CloseDb()
+
+	h := &Health{
+		Templates:   func() bool { return false },
+		IncludesDir: "/nonexistent/includes",
+	}
+
+	code, body := performReadinessRequest(h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unreachable", body.Checks["database"])
+	assert.Equal(t, "not parsed", body.Checks["templates"])
+	assert.Equal(t, "unreadable", body.Checks["includes"])
+}
@@ -1,17 +1,26 @@
 package controllers
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/eirka/eirka-index/assets"
 	"github.com/eirka/eirka-index/templates"
 	"github.com/eirka/eirka-libs/config"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
 	local "github.com/eirka/eirka-index/config"
+	m "github.com/eirka/eirka-index/middleware"
 )
 
 func setupTemplateRouter() *gin.Engine {
@@ -34,6 +43,9 @@ func setupTemplateRouter() *gin.Engine {
 	// Set the template in the router
 	r.SetHTMLTemplate(t)
 
+	// the shells rendered with the templates of other tests
+	shells.Purge()
+
 	return r
 }
 
@@ -133,10 +145,534 @@ func TestErrorControllerTemplateRendering(t *testing.T) {
 
 	// Verify the response
 	assert.Equal(t, http.StatusNotFound, w.Code, "Status code should be 404")
+	assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"), "Error page should not be indexed")
 
 	// Check that the HTML contains expected content
 	html := w.Body.String()
 	assert.Contains(t, html, "ng-app=\"prim\"", "Should contain Angular app directive")
 	assert.Contains(t, html, "test-csrf-token", "Should contain CSRF token")
 	assert.Contains(t, html, "Test Board", "Should contain board title")
+	assert.Contains(t, html, "error:{status: 404 ,code:'not_found',message:'Not Found'}", "Should tell the frontend about the error")
+}
+
+func TestStatusController(t *testing.T) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+
+	testSite := &local.SiteData{
+		Ib:    1,
+		API:   "api.test.com",
+		Img:   "img.test.com",
+		Title: "Test Board",
+	}
+
+	withSite := func(c *gin.Context) {
+		c.Set("sitemap", testSite)
+		c.Set("csrf_token", "test-csrf-token")
+	}
+
+	r.GET("/", withSite, IndexController)
+	r.GET("/status/:status", withSite, func(c *gin.Context) {
+		status, _ := strconv.Atoi(c.Param("status"))
+		StatusController(status)(c)
+	})
+	r.GET("/abort", withSite, func(c *gin.Context) {
+		ErrorPage(c, http.StatusGone)
+	}, func(c *gin.Context) {
+		c.String(http.StatusOK, "should not run")
+	})
+
+	w := performCacheableRequest(r, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "error:", "Index page should not have an error block")
+	assert.Empty(t, w.Header().Get("X-Robots-Tag"), "Index page should be indexed")
+
+	for _, test := range []struct {
+		status int
+		block  string
+	}{
+		{http.StatusNotFound, "error:{status: 404 ,code:'not_found',message:'Not Found'}"},
+		{http.StatusGone, "error:{status: 410 ,code:'gone',message:'Gone'}"},
+		{http.StatusUnavailableForLegalReasons, "error:{status: 451 ,code:'unavailable_for_legal_reasons',message:'Unavailable For Legal Reasons'}"},
+		{http.StatusInternalServerError, "error:{status: 500 ,code:'internal_server_error',message:'Internal Server Error'}"},
+		{http.StatusServiceUnavailable, "error:{status: 503 ,code:'service_unavailable',message:'Service Unavailable'}"},
+	} {
+		w := performCacheableRequest(r, fmt.Sprintf("/status/%d", test.status), "")
+		assert.Equal(t, test.status, w.Code, "Page should have the status")
+		assert.Contains(t, w.Body.String(), test.block, "Page should have the error block")
+		assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"), "Error page should not be indexed")
+	}
+
+	w = performCacheableRequest(r, "/abort", "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.NotContains(t, w.Body.String(), "should not run", "Error page should stop the request")
+}
+
+func TestIndexControllerIntegrity(t *testing.T) {
+	r := setupTemplateRouter()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test.js"), []byte("alert(1)"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test.css"), []byte("body{}"), 0644))
+
+	prim, err := assets.NewManifest(dir, true, "test.js", "test.css")
+	assert.NoError(t, err, "An error was not expected")
+
+	Prim = prim
+	defer func() { Prim = nil }()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = &local.Config{
+		Assets: local.Assets{
+			FontAwesome:          "https://cdn.test.com/font-awesome.css",
+			FontAwesomeIntegrity: "sha384-fontawesome",
+		},
+	}
+
+	r.GET("/", func(c *gin.Context) {
+		c.Set("sitemap", &local.SiteData{Ib: 1, Title: "Test Board"})
+		c.Set("csrf_token", "test-csrf-token")
+		IndexController(c)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(w, req)
+
+	html := w.Body.String()
+	// html/template escapes the + in the digest which browsers decode
+	assert.Contains(t, html, `src="/assets/prim/test.1d3d84f4d7d6.js" integrity="sha384-HT2E9NfWiuQ/w1PRai&#43;hTyqW16NIoCGA/m8VQDUopfAtcz6YQjtsMmQd5uRbVDpW" crossorigin="anonymous"`, "Script should have the fingerprinted url and digest")
+	assert.Contains(t, html, `href="/assets/prim/test.9b2ca0fe143b.css" integrity="sha384-myyg/hQ74aSgjBBvVME/QXAXEkT4Y9dHbVQ5C0lIyGpldvNLJV2IWc5ElXbqLi06" crossorigin="anonymous"`, "Stylesheet should have its digest")
+	assert.Contains(t, html, `href="https://cdn.test.com/font-awesome.css" integrity="sha384-fontawesome" crossorigin="anonymous"`, "Font-awesome should have the configured digest")
+}
+
+func benchmarkIndexController(b *testing.B, settings *local.Config, compress bool, accept string, conditional bool) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = settings
+
+	testSite := &local.SiteData{
+		Ib:    1,
+		API:   "api.test.com",
+		Img:   "img.test.com",
+		Title: "Test Board",
+		Desc:  "A test imageboard",
+		Style: "test.css",
+		Logo:  "logo.png",
+		Imageboards: []local.Imageboard{
+			{Title: "Other Board", Address: "other.board"},
+		},
+	}
+
+	if compress {
+		r.Use(m.Compress(int(local.Settings.Compression.MinSize)))
+	}
+
+	r.GET("/", func(c *gin.Context) {
+		c.Set("sitemap", testSite)
+		// a base64 token like the csrf middleware sets, other values skip the shell cache
+		c.Set("csrf_token", "dGVzdC1jc3JmLXRva2VuLXZhbHVl")
+		IndexController(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept-Encoding", accept)
+	}
+
+	// revalidate the shell from the first response
+	if conditional {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	}
+
+	var size int
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		size = w.Body.Len()
+	}
+
+	b.ReportMetric(float64(size), "body-bytes")
+}
+
+func BenchmarkIndexController(b *testing.B) {
+	benchmarkIndexController(b, local.Defaults(), false, "gzip, br", false)
+}
+
+func BenchmarkIndexControllerNotModified(b *testing.B) {
+	benchmarkIndexController(b, local.Defaults(), true, "gzip, br", true)
+}
+
+func BenchmarkIndexControllerIdentity(b *testing.B) {
+	benchmarkIndexController(b, local.Defaults(), true, "", false)
+}
+
+func BenchmarkIndexControllerGzip(b *testing.B) {
+	benchmarkIndexController(b, local.Defaults(), true, "gzip", false)
+}
+
+func BenchmarkIndexControllerBrotli(b *testing.B) {
+	benchmarkIndexController(b, local.Defaults(), true, "br", false)
+}
+
+// shellSettings are the defaults with the page modes compared by the shell benchmarks
+func shellSettings(cacheable, shellCache bool) *local.Config {
+	settings := local.Defaults()
+	settings.Index.CacheableShell = cacheable
+	settings.Index.ShellCache = shellCache
+	settings.CSP.Enabled = true
+	return settings
+}
+
+func BenchmarkIndexControllerRender(b *testing.B) {
+	benchmarkIndexController(b, shellSettings(false, false), false, "", false)
+}
+
+func BenchmarkIndexControllerShell(b *testing.B) {
+	benchmarkIndexController(b, shellSettings(false, true), false, "", false)
+}
+
+func BenchmarkIndexControllerCacheableRender(b *testing.B) {
+	benchmarkIndexController(b, shellSettings(true, false), false, "", false)
+}
+
+func BenchmarkIndexControllerCacheableShell(b *testing.B) {
+	benchmarkIndexController(b, shellSettings(true, true), false, "", false)
+}
+
+// benchmarkThreadPages requests a page of each of a number of threads in turn, every
+// url has its own canonical and og:url so each one is a separate shell
+func benchmarkThreadPages(b *testing.B, shellCache bool, threads int) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = shellSettings(false, shellCache)
+
+	testSite := &local.SiteData{
+		Ib:    1,
+		API:   "api.test.com",
+		Img:   "img.test.com",
+		Title: "Test Board",
+		Desc:  "A test imageboard",
+	}
+
+	r.GET("/thread/:id/:page", func(c *gin.Context) {
+		c.Set("sitemap", testSite)
+		c.Set("host", "test.board")
+		c.Set("csrf_token", "dGVzdC1jc3JmLXRva2VuLXZhbHVl")
+		IndexController(c)
+	})
+
+	shells.Purge()
+
+	requests := make([]*http.Request, threads)
+	for i := range requests {
+		requests[i], _ = http.NewRequest("GET", fmt.Sprintf("/thread/%d/1", i+1), nil)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, requests[i%threads])
+	}
+
+	b.ReportMetric(float64(shells.Len()), "shells")
+}
+
+func BenchmarkIndexControllerRenderThreads(b *testing.B) {
+	benchmarkThreadPages(b, false, 5000)
+}
+
+// the threads fit in the shell cache
+func BenchmarkIndexControllerShellThreads(b *testing.B) {
+	benchmarkThreadPages(b, true, 500)
+}
+
+// more threads than the shell cache holds so most requests render a new shell
+func BenchmarkIndexControllerShellManyThreads(b *testing.B) {
+	benchmarkThreadPages(b, true, 5000)
+}
+
+func performCacheableRequest(r *gin.Engine, path, etag string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIndexControllerCacheable(t *testing.T) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.CSP.Enabled = true
+
+	testSite := &local.SiteData{
+		Ib:      1,
+		API:     "api.test.com",
+		Img:     "img.test.com",
+		Title:   "Test Board",
+		Discord: "https://discord.com/widget?id=1234",
+	}
+
+	tokens := 0
+
+	handler := func(controller gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			tokens++
+			c.Set("sitemap", testSite)
+			c.Set("csrf_token", fmt.Sprintf("test-csrf-token-%d", tokens))
+			controller(c)
+		}
+	}
+
+	r.GET("/", handler(IndexController))
+	r.GET("/error", handler(ErrorController))
+
+	first := performCacheableRequest(r, "/", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "private, no-cache", first.Header().Get("Cache-Control"))
+	assert.NotContains(t, first.Body.String(), "test-csrf-token", "Shell should not contain the csrf token")
+	assert.Contains(t, first.Body.String(), "csrf_token:(document.cookie.match(", "Shell should read the csrf token from the cookie")
+	assert.Contains(t, first.Body.String(), `discord_widget:'https:\/\/discord.com\/widget?id=1234'+'?1'+Math.floor(Date.now()/1000)`, "Shell should add the discord nonce in the browser")
+	assert.NotContains(t, first.Body.String(), "nonce=", "Shell should not have script nonces")
+
+	etag := first.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag, "Shell should have a strong etag")
+
+	// the inline config script is allowed by its hash
+	policy := first.Header().Get("Content-Security-Policy")
+	assert.Equal(t, inlineScriptHashes(first.Body.Bytes()), []string{strings.Fields(strings.Split(policy, "; ")[1])[2]}, "Policy should allow the inline script hash")
+
+	second := performCacheableRequest(r, "/", "")
+	assert.Equal(t, first.Body.String(), second.Body.String(), "Shell should be the same for every request")
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+	assert.Equal(t, policy, second.Header().Get("Content-Security-Policy"), "Policy should be the same for every request")
+
+	resp := performCacheableRequest(r, "/", etag)
+	assert.Equal(t, http.StatusNotModified, resp.Code, "Matching etag should not be modified")
+	assert.Empty(t, resp.Body.String(), "Not modified should not send the shell")
+	assert.Equal(t, policy, resp.Header().Get("Content-Security-Policy"), "Not modified should keep the policy")
+
+	resp = performCacheableRequest(r, "/", `W/`+etag)
+	assert.Equal(t, http.StatusNotModified, resp.Code, "Compressed weak etag should match")
+
+	resp = performCacheableRequest(r, "/", `"other"`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Other etag should get the shell")
+
+	testSite.Title = "Renamed Board"
+
+	resp = performCacheableRequest(r, "/", etag)
+	assert.Equal(t, http.StatusOK, resp.Code, "Changed site should get the new shell")
+	assert.NotEqual(t, etag, resp.Header().Get("ETag"))
+
+	resp = performCacheableRequest(r, "/error", resp.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Error page should never be not modified")
+	assert.NotEmpty(t, resp.Body.String())
+}
+
+// normalizePage replaces the nonce and the discord cache breaker that change every request
+func normalizePage(w *httptest.ResponseRecorder) string {
+	body := w.Body.String()
+
+	if nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(w.Header().Get("Content-Security-Policy")); nonce != nil {
+		body = strings.ReplaceAll(body, nonce[1], "NONCE")
+	}
+
+	return regexp.MustCompile(`\?1[0-9]+'`).ReplaceAllString(body, "?1TIME'")
+}
+
+func TestIndexControllerShellCache(t *testing.T) {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = shellSettings(false, true)
+
+	generation := uint64(1)
+	TemplateGeneration = func() uint64 { return generation }
+	defer func() { TemplateGeneration = func() uint64 { return 0 } }()
+
+	testSite := &local.SiteData{
+		Ib:      1,
+		API:     "api.test.com",
+		Img:     "img.test.com",
+		Title:   "Test Board",
+		Discord: "https://discord.com/widget?id=1234",
+	}
+
+	var token string
+
+	r.GET("/", func(c *gin.Context) {
+		c.Set("sitemap", testSite)
+		c.Set("csrf_token", token)
+		IndexController(c)
+	})
+
+	// renders the page with the template to compare against the cached shell
+	rendered := func() string {
+		local.Settings.Index.ShellCache = false
+		defer func() { local.Settings.Index.ShellCache = true }()
+		return normalizePage(performCacheableRequest(r, "/", ""))
+	}
+
+	for _, csrf := range []string{"c3RhcnQ+dGVzdC/0b2tlbg==", "b3RoZXI/dG9rZW4+Pz8="} {
+		token = csrf
+
+		resp := performCacheableRequest(r, "/", "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, rendered(), normalizePage(resp), "Shell should match the rendered page")
+		assert.NotContains(t, resp.Body.String(), csrfMarker, "Shell should not leak the markers")
+		assert.Contains(t, resp.Body.String(), `nonce="`, "Shell should have the script nonces")
+	}
+
+	assert.Equal(t, 1, shells.Len(), "Shell should be rendered once")
+
+	testSite.Title = "Renamed Board"
+
+	resp := performCacheableRequest(r, "/", "")
+	assert.Contains(t, resp.Body.String(), "Renamed Board", "Changed site should get a new shell")
+	assert.Equal(t, 2, shells.Len())
+
+	generation++
+
+	resp = performCacheableRequest(r, "/", "")
+	assert.Equal(t, rendered(), normalizePage(resp), "Reloaded templates should get a new shell")
+	assert.Equal(t, 3, shells.Len())
+
+	// values the templates would escape differently are rendered
+	token = "<token>"
+
+	resp = performCacheableRequest(r, "/", "")
+	assert.Equal(t, rendered(), normalizePage(resp), "Unsafe values should be rendered by the template")
+	assert.Equal(t, 3, shells.Len())
+}
+
+func TestInlineScriptHashes(t *testing.T) {
+	body := []byte(`<script src="/a.js"></script><SCRIPT type="text/javascript">alert(1)</SCRIPT><script>alert(1)</script><script></script>`)
+
+	// printf 'alert(1)' | openssl dgst -sha256 -binary | openssl base64 -A
+	assert.Equal(t, []string{
+		"'sha256-bhHHL3z2vDgxUt0W3dWQOrprscmda2Y5pLsLg4GF+pI='",
+		"'sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU='",
+	}, inlineScriptHashes(body), "Inline scripts should be hashed once")
+
+	// the kelvin sign and dotted capital i change length when lowered
+	body = []byte("<title>\u212a\u212a\u212a\u212a \u0130 \xff</title><script>alert(1)</script>")
+
+	assert.Equal(t, []string{
+		"'sha256-bhHHL3z2vDgxUt0W3dWQOrprscmda2Y5pLsLg4GF+pI='",
+	}, inlineScriptHashes(body), "Scripts after non ascii text should be hashed")
+}
+
+func TestShellKeyFields(t *testing.T) {
+	base := func() *pageData {
+		return &pageData{
+			Status: http.StatusOK,
+			Site:   &local.SiteData{Ib: 1, Title: "Test Board", Imageboards: []local.Imageboard{{Title: "Other", Address: "other.board"}}},
+		}
+	}
+
+	// every field that goes in the template has to change the key
+	changes := map[string]func(p *pageData){
+		"Status":               func(p *pageData) { p.Status = http.StatusNotFound },
+		"Site.Ib":              func(p *pageData) { p.Site.Ib = 2 },
+		"Site.API":             func(p *pageData) { p.Site.API = "api" },
+		"Site.Img":             func(p *pageData) { p.Site.Img = "img" },
+		"Site.Title":           func(p *pageData) { p.Site.Title = "title" },
+		"Site.Desc":            func(p *pageData) { p.Site.Desc = "desc" },
+		"Site.Nsfw":            func(p *pageData) { p.Site.Nsfw = true },
+		"Site.Style":           func(p *pageData) { p.Site.Style = "style" },
+		"Site.Logo":            func(p *pageData) { p.Site.Logo = "logo" },
+		"Site.Base":            func(p *pageData) { p.Site.Base = "base/" },
+		"Site.Discord":         func(p *pageData) { p.Site.Discord = "discord" },
+		"Site.Imageboards":     func(p *pageData) { p.Site.Imageboards[0].Address = "another.board" },
+		"PrimJS":               func(p *pageData) { p.PrimJS.Integrity = "sha384-js" },
+		"PrimCSS":              func(p *pageData) { p.PrimCSS.URL = "prim.css" },
+		"FontAwesome":          func(p *pageData) { p.FontAwesome = "fa.css" },
+		"FontAwesomeIntegrity": func(p *pageData) { p.FontAwesomeIntegrity = "sha384-fa" },
+		"OpenGraph":            func(p *pageData) { p.OpenGraph.Image = "image" },
+		"Canonical":            func(p *pageData) { p.Canonical = "canonical" },
+		"Prev":                 func(p *pageData) { p.Prev = "prev" },
+		"Next":                 func(p *pageData) { p.Next = "next" },
+		"Title":                func(p *pageData) { p.Title = "title" },
+		"Description":          func(p *pageData) { p.Description = "desc" },
+		"Robots":               func(p *pageData) { p.Robots = "noindex" },
+		"Noscript":             func(p *pageData) { p.Noscript = &noscriptList{digest: "digest"} },
+		"Cacheable":            func(p *pageData) { p.Cacheable = true },
+		"Nonce":                func(p *pageData) { p.Nonce = "nonce" },
+	}
+
+	key := shellKey(base())
+
+	for name, change := range changes {
+		p := base()
+		change(p)
+		assert.NotEqual(t, key, shellKey(p), "Key should change with %s", name)
+	}
+
+	// the csrf token is spliced in
+	p := base()
+	p.CSRF = "token"
+	assert.Equal(t, key, shellKey(p), "Key should not change with the csrf token")
+
+	// new fields have to be added to the key and this test, the site is checked by its fields
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(pageData{})) {
+		_, ok := changes[field.Name]
+		assert.True(t, ok || field.Name == "CSRF" || field.Name == "Site", "Field %s should be in the shell key", field.Name)
+	}
+
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(local.SiteData{})) {
+		_, ok := changes["Site."+field.Name]
+		assert.True(t, ok, "Field Site.%s should be in the shell key", field.Name)
+	}
 }
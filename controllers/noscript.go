@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+// NoscriptMaxItems is the most posts or threads in a noscript list
+const NoscriptMaxItems = 50
+
+// noscripts caches the noscript lists by imageboard and page
+var noscripts = cache.New[*noscriptList](1000, time.Minute)
+
+// noscriptList is the content of a page for clients without javascript
+type noscriptList struct {
+	Items []noscriptItem
+	// last is set when the page was not full so there is no next page
+	last bool
+	// digest identifies the content in the shell cache key
+	digest string
+}
+
+type noscriptItem struct {
+	// Link is the thread of an index item
+	Link      string
+	Title     string
+	Text      string
+	Thumbnail string
+}
+
+// noscriptPage looks up the noscript list of a route, it is nil if the lookup
+// failed and has no items if the page is empty
+func noscriptPage(c *gin.Context, site *local.SiteData, kind string) *noscriptList {
+	if kind == "" || !local.Settings.Index.Noscript {
+		return nil
+	}
+
+	var id, page uint
+
+	switch kind {
+	case "thread":
+		id, _ = paramID(c.Param("id"))
+		page, _ = paramID(c.Param("page"))
+	case "index":
+		// the first index page has no parameter
+		page = 1
+		if c.Param("id") != "" {
+			page, _ = paramID(c.Param("id"))
+		}
+	}
+
+	if page == 0 || kind == "thread" && id == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%d:%d:%d", kind, site.Ib, id, page)
+
+	if list, ok := noscripts.Get(key); ok {
+		return list
+	}
+
+	var items []models.NoscriptItem
+	var limit uint
+	var err error
+
+	switch kind {
+	case "thread":
+		perPage := noscriptPerPage(config.Settings.Limits.PostsPerPage)
+		limit = min(perPage, NoscriptMaxItems)
+		m := models.NoscriptThreadModel{Ib: site.Ib, Thread: id, Page: page, PerPage: perPage, Limit: limit}
+		err = m.Get()
+		items = m.Result
+	case "index":
+		perPage := noscriptPerPage(config.Settings.Limits.ThreadsPerPage)
+		limit = min(perPage, NoscriptMaxItems)
+		m := models.NoscriptIndexModel{Ib: site.Ib, Page: page, PerPage: perPage, Limit: limit}
+		err = m.Get()
+		items = m.Result
+	}
+
+	if err != nil {
+		// dont cache errors so the lookup is tried again
+		c.Error(err).SetMeta("noscriptPage")
+		return nil
+	}
+
+	list := newNoscriptList(site, kind, items)
+
+	// a page with fewer items than were asked for is the last one
+	list.last = uint(len(items)) < limit
+
+	noscripts.Set(key, list)
+
+	return list
+}
+
+// noscriptPerPage is the page size of the frontend so the pages have the same
+// content, the lists only show the first NoscriptMaxItems of a page
+func noscriptPerPage(perPage uint) uint {
+	if perPage == 0 {
+		return NoscriptMaxItems
+	}
+	return perPage
+}
+
+// newNoscriptList builds the list with links and thumbnail urls
+func newNoscriptList(site *local.SiteData, kind string, items []models.NoscriptItem) *noscriptList {
+	list := &noscriptList{}
+
+	h := sha256.New()
+
+	for _, item := range items {
+		entry := noscriptItem{
+			Title:     item.Title,
+			Text:      item.Text,
+			Thumbnail: feedThumbnail(site, item.Thumbnail),
+		}
+
+		if kind == "index" {
+			entry.Link = fmt.Sprintf("/%sthread/%d/1", site.Base, item.ID)
+		} else {
+			entry.Title = fmt.Sprintf("#%d", item.ID)
+		}
+
+		fmt.Fprintf(h, "%q\x00%q\x00%q\x00%q\x00", entry.Link, entry.Title, entry.Text, entry.Thumbnail)
+
+		list.Items = append(list.Items, entry)
+	}
+
+	list.digest = hex.EncodeToString(h.Sum(nil))
+
+	return list
+}
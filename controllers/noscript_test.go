@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func TestNoscriptPerPage(t *testing.T) {
+	assert.Equal(t, uint(40), noscriptPerPage(40), "Page size of the frontend should be used")
+	assert.Equal(t, uint(500), noscriptPerPage(500), "Large page sizes should keep the frontend pages")
+	assert.Equal(t, uint(NoscriptMaxItems), noscriptPerPage(0), "Missing page size should use the max")
+}
+
+func TestNoscriptController(t *testing.T) {
+	r := setupTemplateRouter()
+
+	noscripts.Purge()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+		Limits: config.Limits{
+			PostsPerPage:   100,
+			ThreadsPerPage: 10,
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.Index.Noscript = true
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board", Base: "", Img: "img.test.board"}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("sitemap", site)
+		c.Set("csrf_token", "test-csrf-token")
+	})
+
+	for _, route := range []local.Route{
+		{Path: "/thread/:id/:page", Noscript: "thread"},
+		{Path: "/page/:id", Noscript: "index"},
+		{Path: "/"},
+	} {
+		controller, err := RouteController(route)
+		assert.NoError(t, err, "An error was not expected")
+		r.GET(route.Path, controller)
+	}
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT post_num,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\),post_time FROM posts`).
+		WithArgs(10, 1, NoscriptMaxItems, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"post_num", "post_text", "image_thumbnail", "post_time"}).
+			AddRow(41, "a reply <b>here</b>", "41s.jpg", now).
+			AddRow(42, "no image", "", now))
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\),thread_last_post FROM threads`).
+		WithArgs(1, 10, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_id", "thread_title", "post_text", "image_thumbnail", "thread_last_post"}).
+			AddRow(7, "Cool Thread", "the first post", "7s.jpg", now))
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title`).
+		WithArgs(1, 10, 20).
+		WillReturnError(errors.New("connection lost"))
+
+	resp := performCacheableRequest(r, "/thread/10/2", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "<noscript>", "Thread should have the noscript list")
+	assert.Contains(t, resp.Body.String(), "<strong>#41</strong>", "Posts should have their number")
+	assert.Contains(t, resp.Body.String(), "a reply &lt;b&gt;here&lt;/b&gt;", "Post text should be escaped")
+	assert.Contains(t, resp.Body.String(), `<img src="https://img.test.board/thumb/41s.jpg"`, "Posts should have their thumbnail")
+
+	resp = performCacheableRequest(r, "/page/2", "")
+	assert.Contains(t, resp.Body.String(), `<a href="/thread/7/1">Cool Thread</a>`, "Index should link to the threads")
+
+	// the failed lookup is not cached and the page still renders
+	resp = performCacheableRequest(r, "/page/3", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "<noscript>", "Failed lookups should not have the noscript list")
+
+	resp = performCacheableRequest(r, "/", "")
+	assert.NotContains(t, resp.Body.String(), "<noscript>", "Routes without noscript should not have the list")
+
+	// the lists are cached
+	resp = performCacheableRequest(r, "/thread/10/2", "")
+	assert.Contains(t, resp.Body.String(), "<strong>#42</strong>")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+
+	local.Settings.Index.Noscript = false
+
+	resp = performCacheableRequest(r, "/page/2", "")
+	assert.NotContains(t, resp.Body.String(), "<noscript>", "Noscript should be optional")
+}
+
+func TestNoscriptLastPage(t *testing.T) {
+	r := setupTemplateRouter()
+
+	noscripts.Purge()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+		Limits: config.Limits{
+			ThreadsPerPage: 2,
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.Index.Noscript = true
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board"}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("sitemap", site)
+		c.Set("host", "test.board")
+		c.Set("csrf_token", "test-csrf-token")
+	})
+
+	controller, err := RouteController(local.Route{Path: "/page/:id", Noscript: "index", First: "/"})
+	assert.NoError(t, err, "An error was not expected")
+	r.GET("/page/:id", controller)
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	now := time.Now()
+	columns := []string{"thread_id", "thread_title", "post_text", "image_thumbnail", "thread_last_post"}
+
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title`).
+		WithArgs(1, 2, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(7, "Cool Thread", "the first post", "", now).
+			AddRow(8, "Other Thread", "another post", "", now))
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title`).
+		WithArgs(1, 2, 4).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(9, "Old Thread", "an old post", "", now))
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title`).
+		WithArgs(1, 2, 6).
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(`SELECT threads.thread_id,thread_title`).
+		WithArgs(1, 2, 8).
+		WillReturnError(errors.New("connection lost"))
+
+	resp := performCacheableRequest(r, "/page/2", "")
+	assert.Contains(t, resp.Body.String(), `<link rel="next" href="http://test.board/page/3" />`, "Full page should link the next page")
+
+	resp = performCacheableRequest(r, "/page/3", "")
+	assert.Contains(t, resp.Body.String(), `<link rel="prev" href="http://test.board/page/2" />`)
+	assert.NotContains(t, resp.Body.String(), `rel="next"`, "Last page should not link a next page")
+
+	resp = performCacheableRequest(r, "/page/4", "")
+	assert.NotContains(t, resp.Body.String(), `rel="next"`, "Empty page should not link a next page")
+	assert.NotContains(t, resp.Body.String(), "<noscript>", "Empty page should not have the noscript list")
+
+	resp = performCacheableRequest(r, "/page/5", "")
+	assert.NotContains(t, resp.Body.String(), `rel="next"`, "Unknown page should not link a next page")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
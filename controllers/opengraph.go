@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+// summaries caches thread and image lookups, a nil value means it was not found
+var summaries = cache.New[*models.Summary](1000, 10*time.Minute)
+
+// OpenGraph holds the social media preview tags for a page
+type OpenGraph struct {
+	Site  string
+	Title string
+	Desc  string
+	Image string
+	URL   string
+	Card  string
+}
+
+// openGraph builds the preview tags for the request with the summary of its
+// content, falling back to the board defaults
+func openGraph(c *gin.Context, site *local.SiteData, summary *models.Summary) OpenGraph {
+	origin := siteOrigin(c, c.GetString("host"))
+
+	og := OpenGraph{
+		Site:  site.Title,
+		Title: site.Title,
+		Desc:  site.Desc,
+		URL:   absoluteURL(origin, c.Request.URL.Path),
+		Card:  "summary",
+	}
+
+	if site.Logo != "" {
+		og.Image = absoluteURL(origin, "/assets/logo/"+site.Logo)
+	}
+
+	if summary == nil {
+		return og
+	}
+
+	og.Title = fmt.Sprintf("%s - %s", summary.Title, site.Title)
+
+	if summary.Excerpt != "" {
+		og.Desc = summary.Excerpt
+	}
+
+	if summary.Thumbnail != "" {
+		og.Image = absoluteURL(site.Img, "/thumb/"+summary.Thumbnail)
+	}
+
+	return og
+}
+
+// pageSummary looks up the thread, tag or image in the id parameter
+func pageSummary(c *gin.Context, site *local.SiteData, kind string) *models.Summary {
+	if kind == "" {
+		return nil
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%d:%d", kind, site.Ib, id)
+
+	if summary, ok := summaries.Get(key); ok {
+		return summary
+	}
+
+	var summary *models.Summary
+
+	switch kind {
+	case models.ContentThread:
+		m := models.ThreadSummaryModel{Ib: site.Ib, Thread: uint(id)}
+		err = m.Get()
+		summary = &m.Result
+	case models.ContentTag:
+		m := models.TagSummaryModel{Ib: site.Ib, Tag: uint(id)}
+		err = m.Get()
+		summary = &m.Result
+	case models.ContentImage:
+		m := models.ImageSummaryModel{Ib: site.Ib, Image: uint(id)}
+		err = m.Get()
+		summary = &m.Result
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		summary = nil
+	} else if err != nil {
+		// dont cache errors so the lookup is tried again
+		c.Error(err).SetMeta("pageSummary")
+		return nil
+	}
+
+	summaries.Set(key, summary)
+
+	return summary
+}
+
+// absoluteURL adds a scheme to a host if it is missing
+func absoluteURL(host, path string) string {
+	switch {
+	case strings.HasPrefix(host, "http://"), strings.HasPrefix(host, "https://"):
+		return strings.TrimSuffix(host, "/") + path
+	case strings.HasPrefix(host, "//"):
+		return "https:" + strings.TrimSuffix(host, "/") + path
+	}
+
+	return "https://" + strings.TrimSuffix(host, "/") + path
+}
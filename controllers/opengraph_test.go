@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+func setupOpenGraphRouter() *gin.Engine {
+	r := setupTemplateRouter()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	testSite := &local.SiteData{
+		Ib:    1,
+		Img:   "img.test.com",
+		Title: "Test Board",
+		Desc:  "A test imageboard",
+		Logo:  "logo.png",
+	}
+
+	setup := func(c *gin.Context) {
+		c.Set("host", "test.board")
+		c.Set("sitemap", testSite)
+		c.Set("csrf_token", "test-csrf-token")
+	}
+
+	local.Settings = local.Defaults()
+
+	thread, _ := RouteController(local.Route{Path: "/thread/:id/:page", Content: models.ContentThread})
+	image, _ := RouteController(local.Route{Path: "/image/:id", Content: models.ContentImage})
+
+	r.GET("/thread/:id/:page", setup, thread)
+	r.GET("/image/:id", setup, image)
+
+	return r
+}
+
+func TestOpenGraphThread(t *testing.T) {
+	r := setupOpenGraphRouter()
+	summaries.Purge()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\) FROM threads`).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_title", "post_text", "image_thumbnail"}).
+			AddRow("Cool Thread", "the first post", "123s.jpg"))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/thread/10/1", nil)
+		r.ServeHTTP(w, req)
+
+		html := w.Body.String()
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, html, `<meta property="og:title" content="Cool Thread - Test Board" />`)
+		assert.Contains(t, html, `<meta property="og:description" content="the first post" />`)
+		assert.Contains(t, html, `<meta property="og:image" content="https://img.test.com/thumb/123s.jpg" />`)
+		assert.Contains(t, html, `<meta property="og:url" content="http://test.board/thread/10/1" />`)
+		assert.Contains(t, html, `<meta name="twitter:card" content="summary" />`)
+	}
+
+	// the second request should be served from the cache
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestOpenGraphFallback(t *testing.T) {
+	r := setupOpenGraphRouter()
+	summaries.Purge()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),image_thumbnail FROM images`).
+		WithArgs(5, 1).
+		WillReturnError(fmt.Errorf("database error"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/image/5", nil)
+	r.ServeHTTP(w, req)
+
+	html := w.Body.String()
+	assert.Equal(t, http.StatusOK, w.Code, "Lookup errors should not fail the page")
+	assert.Contains(t, html, `<meta property="og:title" content="Test Board" />`)
+	assert.Contains(t, html, `<meta property="og:description" content="A test imageboard" />`)
+	assert.Contains(t, html, `<meta property="og:image" content="http://test.board/assets/logo/logo.png" />`)
+
+	assert.Equal(t, 0, summaries.Len(), "Errors should not be cached")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	assert.Equal(t, "https://img.test.com/thumb/a.jpg", absoluteURL("img.test.com", "/thumb/a.jpg"))
+	assert.Equal(t, "http://test.board/images/thumb/a.jpg", absoluteURL("http://test.board/images/", "/thumb/a.jpg"))
+	assert.Equal(t, "https://img.test.com/thumb/a.jpg", absoluteURL("//img.test.com", "/thumb/a.jpg"))
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-index/assets"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/metrics"
+	m "github.com/eirka/eirka-index/middleware"
+	"github.com/eirka/eirka-index/models"
+)
+
+// pageError tells the frontend which error view to show on the first load,
+// 410 has the code gone and 503 service_unavailable
+func pageError(status int) gin.H {
+	message := http.StatusText(status)
+
+	return gin.H{
+		"status":  status,
+		"code":    strings.ToLower(strings.ReplaceAll(message, " ", "_")),
+		"message": message,
+	}
+}
+
+// pageMeta is what a route adds to the page head
+type pageMeta struct {
+	// Title replaces the imageboard title in the title tag
+	Title string
+	// Description replaces the imageboard description
+	Description string
+	// Robots is the robots meta directive
+	Robots string
+	// Summary is the thread, tag or image of the page for the preview tags
+	Summary *models.Summary
+	// Noscript is the content shown to clients without javascript
+	Noscript *noscriptList
+}
+
+// pageData is everything that goes in the index template, the shell cache key
+// is built from its fields
+type pageData struct {
+	Status int
+	Site   *local.SiteData
+	// the prim files with their integrity digests
+	PrimJS               assets.Asset
+	PrimCSS              assets.Asset
+	FontAwesome          string
+	FontAwesomeIntegrity string
+	OpenGraph            OpenGraph
+	// the canonical url and the pagination links
+	Canonical   string
+	Prev        string
+	Next        string
+	Title       string
+	Description string
+	Robots      string
+	Noscript    *noscriptList
+	Cacheable   bool
+	// the per request values that are spliced in the shell
+	CSRF  string
+	Nonce string
+}
+
+// template returns the data for the index template
+func (p *pageData) template() gin.H {
+	var pageErr gin.H
+
+	if p.Status >= http.StatusBadRequest {
+		pageErr = pageError(p.Status)
+	}
+
+	// an empty page has no noscript list
+	var noscript *noscriptList
+
+	if p.Noscript != nil && len(p.Noscript.Items) > 0 {
+		noscript = p.Noscript
+	}
+
+	return gin.H{
+		"primjs":                p.PrimJS.URL,
+		"primjs_integrity":      p.PrimJS.Integrity,
+		"primcss":               p.PrimCSS.URL,
+		"primcss_integrity":     p.PrimCSS.Integrity,
+		"fontawesome":           p.FontAwesome,
+		"fontawesome_integrity": p.FontAwesomeIntegrity,
+		"ib":                    p.Site.Ib,
+		"base":                  p.Site.Base,
+		"apisrv":                p.Site.API,
+		"imgsrv":                p.Site.Img,
+		"title":                 p.Site.Title,
+		"desc":                  p.Site.Desc,
+		"nsfw":                  p.Site.Nsfw,
+		"style":                 p.Site.Style,
+		"logo":                  p.Site.Logo,
+		"discord":               p.Site.Discord,
+		"imageboards":           p.Site.Imageboards,
+		"csrf":                  p.CSRF,
+		"og":                    p.OpenGraph,
+		"nonce":                 p.Nonce,
+		"cacheable":             p.Cacheable,
+		"error":                 pageErr,
+		"canonical":             p.Canonical,
+		"prev":                  p.Prev,
+		"next":                  p.Next,
+		"page_title":            p.Title,
+		"page_desc":             p.Description,
+		"robots":                p.Robots,
+		"noscript":              noscript,
+	}
+}
+
+// page renders the angularjs shell with a status, the frontend gets an error
+// block in its config for 4xx and 5xx statuses
+func page(c *gin.Context, status int, meta pageMeta) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	// the per request values are left out of a cacheable shell
+	cacheable := local.Settings.Index.CacheableShell
+
+	// social media preview tags
+	og := openGraph(c, site, meta.Summary)
+
+	var canonical, prev, next string
+
+	if status == http.StatusOK {
+		// the canonical url and the pagination links for search engines
+		canonical, prev, next = pageLinks(c, site)
+
+		// only the noscript lookup knows there is a next page
+		if meta.Noscript == nil || meta.Noscript.last {
+			next = ""
+		}
+	}
+
+	if status >= http.StatusBadRequest {
+		if meta.Title == "" {
+			meta.Title = fmt.Sprintf("%s - %s", http.StatusText(status), site.Title)
+		}
+
+		// error pages are not indexed and dont leak the url
+		m.ErrorHeaders(c)
+	}
+
+	data := &pageData{
+		Status:               status,
+		Site:                 site,
+		PrimJS:               Prim.Lookup(config.Settings.Prim.JS),
+		PrimCSS:              Prim.Lookup(config.Settings.Prim.CSS),
+		FontAwesome:          local.Settings.Assets.FontAwesome,
+		FontAwesomeIntegrity: local.Settings.Assets.FontAwesomeIntegrity,
+		OpenGraph:            og,
+		Canonical:            canonical,
+		Prev:                 prev,
+		Next:                 next,
+		Title:                meta.Title,
+		Description:          meta.Description,
+		Robots:               meta.Robots,
+		Noscript:             meta.Noscript,
+		Cacheable:            cacheable,
+	}
+
+	if !cacheable {
+		// the shell reads the token from the cookie instead
+		data.CSRF = c.MustGet("csrf_token").(string)
+
+		// nonce for the inline scripts allowed by the content security policy
+		data.Nonce = contentSecurityPolicy(c, site)
+	}
+
+	start := time.Now()
+
+	sendPage(c, data)
+
+	metrics.ObserveTemplate("index", start)
+
+}
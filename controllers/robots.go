@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+// robotsDisallow are the angularjs routes that should never be crawled
+var robotsDisallow = []string{"account", "admin", "favorites"}
+
+// RobotsController generates the robots.txt for the imageboard
+func RobotsController(c *gin.Context) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	host := c.GetString("host")
+
+	// a board can replace the whole file
+	if override, ok := local.Settings.Robots.Boards[host]; ok {
+		c.String(http.StatusOK, override)
+		return
+	}
+
+	var robots strings.Builder
+
+	robots.WriteString("User-agent: *\n")
+
+	// adult boards can block indexing entirely
+	if site.Nsfw && local.Settings.Robots.BlockNsfw {
+		robots.WriteString("Disallow: /\n")
+		c.String(http.StatusOK, robots.String())
+		return
+	}
+
+	for _, path := range robotsDisallow {
+		fmt.Fprintf(&robots, "Disallow: /%s%s\n", site.Base, path)
+	}
+
+	for _, path := range local.Settings.Robots.Disallow {
+		fmt.Fprintf(&robots, "Disallow: %s\n", path)
+	}
+
+	if sitemapAllowed(site) {
+		fmt.Fprintf(&robots, "\nSitemap: %s\n", absoluteURL(siteOrigin(c, host), fmt.Sprintf("/%ssitemap.xml", site.Base)))
+	}
+
+	c.String(http.StatusOK, robots.String())
+
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func performRobotsRequest(site *local.SiteData, host string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.GET("/robots.txt", func(c *gin.Context) {
+		c.Set("host", host)
+		c.Set("sitemap", site)
+	}, RobotsController)
+
+	req, _ := http.NewRequest("GET", "/robots.txt", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRobotsDefault(t *testing.T) {
+	local.Settings = &local.Config{
+		Robots: local.Robots{
+			Disallow: []string{"/trending"},
+		},
+	}
+
+	resp := performRobotsRequest(&local.SiteData{Ib: 1}, "test.board")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "User-agent: *\n"+
+		"Disallow: /account\n"+
+		"Disallow: /admin\n"+
+		"Disallow: /favorites\n"+
+		"Disallow: /trending\n"+
+		"\n"+
+		"Sitemap: http://test.board/sitemap.xml\n", resp.Body.String())
+}
+
+func TestRobotsNsfw(t *testing.T) {
+	local.Settings = &local.Config{
+		Sitemap: local.Sitemap{ExcludeNsfw: true},
+	}
+
+	resp := performRobotsRequest(&local.SiteData{Ib: 1, Nsfw: true}, "test.board")
+	assert.NotContains(t, resp.Body.String(), "Sitemap:", "Excluded boards should not link a sitemap")
+	assert.NotContains(t, resp.Body.String(), "Disallow: /\n", "Adult boards are only blocked when configured")
+
+	local.Settings.Robots.BlockNsfw = true
+
+	resp = performRobotsRequest(&local.SiteData{Ib: 1, Nsfw: true}, "test.board")
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", resp.Body.String(), "Adult boards should block all crawling")
+
+	resp = performRobotsRequest(&local.SiteData{Ib: 2}, "test.board")
+	assert.Contains(t, resp.Body.String(), "Sitemap:", "Other boards should be unaffected")
+}
+
+func TestRobotsOverride(t *testing.T) {
+	local.Settings = &local.Config{
+		Robots: local.Robots{
+			Boards: map[string]string{"test.board": "User-agent: *\nDisallow: /secret\n"},
+		},
+	}
+
+	resp := performRobotsRequest(&local.SiteData{Ib: 1}, "test.board")
+	assert.Equal(t, "User-agent: *\nDisallow: /secret\n", resp.Body.String(), "Override should replace the file")
+
+	resp = performRobotsRequest(&local.SiteData{Ib: 2}, "other.board")
+	assert.Contains(t, resp.Body.String(), "Disallow: /account", "Other domains should get the default")
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+// RouteController generates the page for a route in the route table
+func RouteController(route local.Route) (gin.HandlerFunc, error) {
+	title, err := route.ParseTitle()
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := route.ParseDescription()
+	if err != nil {
+		return nil, err
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return func(c *gin.Context) {
+
+		// get sitemap from session middleware
+		site := c.MustGet("sitemap").(*local.SiteData)
+
+		meta := pageMeta{
+			Robots: route.Robots,
+		}
+
+		// missing and deleted content gets the error page without the route title
+		if route.Content != "" && status == http.StatusOK && local.Settings.Index.CheckContent {
+			if checked := contentStatus(c, site, route.Content); checked != http.StatusOK {
+				page(c, checked, meta)
+				return
+			}
+		}
+
+		// the cached thread, tag or image for the titles and preview tags
+		meta.Summary = pageSummary(c, site, route.Content)
+
+		data := local.RouteData{
+			Site:   site.Title,
+			Desc:   site.Desc,
+			Params: make(map[string]string),
+		}
+
+		for _, param := range c.Params {
+			data.Params[param.Key] = param.Value
+		}
+
+		if meta.Summary != nil {
+			data.Name = meta.Summary.Title
+			data.Excerpt = meta.Summary.Excerpt
+		}
+
+		meta.Title = routeText(c, title, data)
+		meta.Description = routeText(c, description, data)
+
+		// the posts for crawlers and text browsers
+		meta.Noscript = noscriptPage(c, site, route.Noscript)
+
+		page(c, status, meta)
+
+	}, nil
+}
+
+// routeText executes a template of a route, it is empty so the imageboard
+// defaults are used when there is no template or it fails
+func routeText(c *gin.Context, t *template.Template, data local.RouteData) string {
+	if t == nil {
+		return ""
+	}
+
+	var b strings.Builder
+
+	err := t.Execute(&b, data)
+	if err != nil {
+		c.Error(err).SetMeta("routeText")
+		return ""
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/eirka/eirka-libs/config"
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func TestRouteController(t *testing.T) {
+	r := setupTemplateRouter()
+
+	contents.Purge()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+	local.Settings.Index.CheckContent = true
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board"}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("sitemap", site)
+		c.Set("csrf_token", "test-csrf-token")
+	})
+
+	for _, route := range []local.Route{
+		{Path: "/page/:id", Title: "Page {{ .Params.id }} - {{ .Site }}"},
+		{Path: "/account", Title: "Account - {{ .Site }}", Robots: "noindex, nofollow"},
+		{Path: "/removed", Status: http.StatusGone, Title: "Removed - {{ .Site }}"},
+		{Path: "/tag/:id/:page", Title: "Tag {{ .Params.id }} - {{ .Site }}", Content: "tag"},
+		{Path: "/"},
+	} {
+		controller, err := RouteController(route)
+		assert.NoError(t, err, "An error was not expected")
+		r.GET(route.Path, controller)
+	}
+
+	resp := performCacheableRequest(r, "/page/3", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">Page 3 - Test Board</title>`, "Page should have the route title")
+	assert.NotContains(t, resp.Body.String(), `name="robots"`, "Page should not have a robots directive")
+
+	resp = performCacheableRequest(r, "/account", "")
+	assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">Account - Test Board</title>`)
+	assert.Contains(t, resp.Body.String(), `<meta name="robots" content="noindex, nofollow" />`, "Page should have the route robots directive")
+
+	resp = performCacheableRequest(r, "/removed", "")
+	assert.Equal(t, http.StatusGone, resp.Code, "Page should have the route status")
+	assert.Contains(t, resp.Body.String(), "code:'gone'", "Page should have the error block")
+
+	resp = performCacheableRequest(r, "/", "")
+	assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">Test Board</title>`, "Route without a title should have the imageboard title")
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT 0 FROM tags`).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted"}))
+
+	resp = performCacheableRequest(r, "/tag/3/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Missing content should be not found")
+	assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">Not Found - Test Board</title>`, "Missing content should have the error title")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+
+	_, err = RouteController(local.Route{Path: "/", Title: "{{ .Site"})
+	assert.Error(t, err, "Bad title templates should be an error")
+}
+
+func TestRouteTitles(t *testing.T) {
+	r := setupTemplateRouter()
+
+	summaries.Purge()
+
+	config.Settings = &config.Config{
+		Prim: config.Prim{
+			CSS: "test.css",
+			JS:  "test.js",
+		},
+	}
+
+	local.Settings = local.Defaults()
+
+	site := &local.SiteData{Ib: 1, Title: "Test Board", Desc: "A test imageboard"}
+
+	r.Use(func(c *gin.Context) {
+		c.Set("sitemap", site)
+		c.Set("csrf_token", "test-csrf-token")
+	})
+
+	for _, route := range local.DefaultRoutes() {
+		controller, err := RouteController(route)
+		assert.NoError(t, err, "Default routes should have valid templates")
+		r.GET(route.Path, controller)
+	}
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\) FROM threads`).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_title", "post_text", "image_thumbnail"}).
+			AddRow("Cool Thread", "the first post", ""))
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\) FROM threads`).
+		WithArgs(12, 1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT tag_name FROM tags`).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"tag_name"}).AddRow("landscape"))
+
+	for _, test := range []struct {
+		path, title, desc string
+	}{
+		{"/thread/10/1", "Cool Thread - Test Board", "the first post"},
+		{"/thread/12/1", "Thread 12 - Test Board", "A test imageboard"},
+		{"/tag/3/1", "Tag: landscape - Test Board", "Images tagged landscape on Test Board"},
+		{"/page/3", "Page 3 - Test Board", "A test imageboard"},
+		{"/trending", "Trending - Test Board", "A test imageboard"},
+		{"/", "Test Board", "A test imageboard"},
+		{"/error", "Not Found - Test Board", "A test imageboard"},
+	} {
+		resp := performCacheableRequest(r, test.path, "")
+		assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">`+test.title+`</title>`, "Page should have its title: %s", test.path)
+		assert.Contains(t, resp.Body.String(), `<meta name="description" content="`+test.desc+`" />`, "Page should have its description: %s", test.path)
+	}
+
+	// the names are cached
+	resp := performCacheableRequest(r, "/thread/10/2", "")
+	assert.Contains(t, resp.Body.String(), `<title ng-bind="page.title">Cool Thread - Test Board</title>`)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
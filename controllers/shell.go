@@ -0,0 +1,432 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+)
+
+// TemplateGeneration reports the version of the template set, it is set by the
+// app so the cached shells are rendered again after the templates reload
+var TemplateGeneration = func() uint64 { return 0 }
+
+// shells caches the rendered pages keyed by their template data
+var shells = cache.New[*renderedShell](1000, 10*time.Minute)
+
+// the markers stand in for the per request values while a shell is rendered
+var (
+	csrfMarker  = newMarker()
+	nonceMarker = newMarker()
+	timeMarker  = newMarker()
+)
+
+// newMarker returns a random string that is not changed by the template escaping
+func newMarker() string {
+	return "eirka" + rand.Text()
+}
+
+// the characters of the per request values that the template may escape
+const escapable = "+/="
+
+// renderedShell is a page split where the per request values go
+type renderedShell struct {
+	parts [][]byte
+	// the values that follow each part but the last
+	slots []slot
+	// the etag and inline script hashes of a cacheable shell
+	etag    string
+	scripts []string
+}
+
+// slot is where a value goes and how the template escaped it there
+type slot struct {
+	marker  string
+	escaper *strings.Replacer
+}
+
+// bufferedWriter holds a rendered page so it can be checked before sending
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// sendPage sends the index template. The shell is rendered once for its data and
+// the csrf token, script nonce and discord cache breaker are spliced in for every
+// request. A cacheable shell has none of them so it is sent with an etag and
+// answered with a 304 when it did not change.
+func sendPage(c *gin.Context, page *pageData) {
+	status, site, cacheable := page.Status, page.Site, page.Cacheable
+
+	data := page.template()
+
+	values := map[string]string{
+		csrfMarker:  page.CSRF,
+		nonceMarker: page.Nonce,
+		// add a cache breaker because their thing is dumb
+		timeMarker: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+
+	if !local.Settings.Index.ShellCache || !spliceable(values) {
+		renderPage(c, status, site, withValues(data, site, cacheable, values))
+		return
+	}
+
+	key := shellKey(page)
+
+	shell, ok := shells.Get(key)
+	if !ok {
+		var err error
+
+		shell, err = renderShell(c, status, site, cacheable, data)
+		if errors.Is(err, errMarker) {
+			// the page is still fine without the cache
+			c.Error(err).SetMeta("sendPage.renderShell")
+			renderPage(c, status, site, withValues(data, site, cacheable, values))
+			return
+		} else if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		shells.Set(key, shell)
+	}
+
+	if cacheable {
+		sendCacheable(c, status, site, shell)
+		return
+	}
+
+	c.Data(status, "text/html; charset=utf-8", shell.splice(values))
+}
+
+// renderPage sends the index template without the shell cache
+func renderPage(c *gin.Context, status int, site *local.SiteData, data gin.H) {
+	if !local.Settings.Index.CacheableShell {
+		c.HTML(status, "index", data)
+		return
+	}
+
+	body, err := render(c, status, data)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	sendCacheable(c, status, site, newCacheableShell(body))
+}
+
+// sendCacheable sends a shell without per request values with its etag
+func sendCacheable(c *gin.Context, status int, site *local.SiteData, shell *renderedShell) {
+	// a nonce would change the page on every request so the inline scripts are allowed by hash
+	if local.Settings.CSP.Enabled {
+		setContentSecurityPolicy(c, site, shell.scripts...)
+	}
+
+	// the csrf cookies are still set on every response
+	c.Header("Cache-Control", "private, no-cache")
+
+	if status == http.StatusOK && notModified(c, shell.etag, time.Time{}) {
+		return
+	}
+
+	c.Data(status, "text/html; charset=utf-8", shell.parts[0])
+}
+
+// errMarker is returned when a marker was changed by the template
+var errMarker = errors.New("shell marker not found in the rendered page")
+
+// renderShell renders the page with markers in place of the per request values.
+// Each marker is followed by the escapable characters so the shell knows how to
+// escape a value for the place it is put in.
+func renderShell(c *gin.Context, status int, site *local.SiteData, cacheable bool, data gin.H) (*renderedShell, error) {
+	// a cacheable shell has nothing to splice
+	if cacheable {
+		body, err := render(c, status, withValues(data, site, cacheable, nil))
+		if err != nil {
+			return nil, err
+		}
+
+		return newCacheableShell(body), nil
+	}
+
+	markers := make(map[string]string)
+
+	for _, m := range []string{csrfMarker, nonceMarker, timeMarker} {
+		probe := m
+		for _, r := range escapable {
+			probe += string(r) + m
+		}
+		markers[m] = probe
+	}
+
+	// an empty nonce leaves the attribute out
+	if data["nonce"] == "" {
+		markers[nonceMarker] = ""
+	}
+
+	body, err := render(c, status, withValues(data, site, cacheable, markers))
+	if err != nil {
+		return nil, err
+	}
+
+	shell := &renderedShell{}
+
+	for {
+		next, marker := -1, ""
+
+		for _, m := range []string{csrfMarker, nonceMarker, timeMarker} {
+			if i := bytes.Index(body, []byte(m)); i != -1 && (next == -1 || i < next) {
+				next, marker = i, m
+			}
+		}
+
+		if next == -1 {
+			break
+		}
+
+		shell.parts = append(shell.parts, body[:next])
+		body = body[next+len(marker):]
+
+		var pairs []string
+
+		for _, r := range escapable {
+			end := bytes.Index(body, []byte(marker))
+			if end == -1 {
+				return nil, errMarker
+			}
+
+			if escaped := string(body[:end]); escaped != string(r) {
+				pairs = append(pairs, string(r), escaped)
+			}
+
+			body = body[end+len(marker):]
+		}
+
+		s := slot{marker: marker}
+		if len(pairs) > 0 {
+			s.escaper = strings.NewReplacer(pairs...)
+		}
+
+		shell.slots = append(shell.slots, s)
+	}
+
+	shell.parts = append(shell.parts, body)
+
+	return shell, nil
+}
+
+// render executes the index template into a buffer
+func render(c *gin.Context, status int, data gin.H) ([]byte, error) {
+	w := &bufferedWriter{ResponseWriter: c.Writer}
+
+	count := len(c.Errors)
+
+	c.Writer = w
+	c.HTML(status, "index", data)
+	c.Writer = w.ResponseWriter
+
+	// the render error was already added to the context
+	if len(c.Errors) > count {
+		return nil, c.Errors.Last()
+	}
+
+	return w.body.Bytes(), nil
+}
+
+// newCacheableShell hashes a page that has no per request values
+func newCacheableShell(body []byte) *renderedShell {
+	return &renderedShell{
+		parts:   [][]byte{body},
+		etag:    bodyETag(body),
+		scripts: inlineScriptHashes(body),
+	}
+}
+
+// withValues returns a copy of the template data with the per request values
+func withValues(data gin.H, site *local.SiteData, cacheable bool, values map[string]string) gin.H {
+	copied := make(gin.H, len(data)+1)
+	for k, v := range data {
+		copied[k] = v
+	}
+
+	copied["csrf"] = values[csrfMarker]
+	copied["nonce"] = values[nonceMarker]
+
+	// the cacheable shell adds the cache breaker in the browser
+	if site.Discord != "" && !cacheable {
+		copied["discord"] = fmt.Sprintf("%s?%d%s", site.Discord, site.Ib, values[timeMarker])
+	}
+
+	return copied
+}
+
+// splice puts the per request values in the shell
+func (s *renderedShell) splice(values map[string]string) []byte {
+	size := 0
+	for _, part := range s.parts {
+		size += len(part)
+	}
+
+	page := make([]byte, 0, size+128)
+
+	for i, part := range s.parts {
+		page = append(page, part...)
+		if i < len(s.slots) {
+			value := values[s.slots[i].marker]
+			if s.slots[i].escaper != nil {
+				value = s.slots[i].escaper.Replace(value)
+			}
+			page = append(page, value...)
+		}
+	}
+
+	return page
+}
+
+// shellKey identifies a shell by the page data without the per request values.
+// The canonical, og:url, pagination links, titles and noscript list of a url are
+// part of the key, so every url is its own shell and only pages requested again
+// within the ttl are served from the cache. They are escaped differently in each
+// attribute and the links are left out for some pages, so they are rendered by the
+// template instead of being spliced like the csrf token and nonce.
+func shellKey(page *pageData) string {
+	h := sha256.New()
+
+	// the nonce attribute is left out when there is no nonce
+	fmt.Fprintf(h, "%d\x00%t\x00%t\x00%d", page.Status, page.Cacheable, page.Nonce != "", TemplateGeneration())
+
+	site := page.Site
+
+	fmt.Fprintf(h, "\x00%d\x00%t", site.Ib, site.Nsfw)
+	keyStrings(h, site.API, site.Img, site.Title, site.Desc, site.Style, site.Logo, site.Base, site.Discord)
+
+	fmt.Fprintf(h, "\x00%d", len(site.Imageboards))
+	for _, ib := range site.Imageboards {
+		keyStrings(h, ib.Title, ib.Address)
+	}
+
+	keyStrings(h, page.PrimJS.URL, page.PrimJS.Integrity, page.PrimCSS.URL, page.PrimCSS.Integrity, page.FontAwesome, page.FontAwesomeIntegrity)
+
+	og := page.OpenGraph
+	keyStrings(h, og.Site, og.Title, og.Desc, og.Image, og.URL, og.Card)
+
+	keyStrings(h, page.Canonical, page.Prev, page.Next, page.Title, page.Description, page.Robots)
+
+	// the noscript list is identified by its content
+	var noscript string
+	if page.Noscript != nil {
+		noscript = page.Noscript.digest
+	}
+	keyStrings(h, noscript)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keyStrings adds quoted values to a key so they can not run into each other
+func keyStrings(w io.Writer, values ...string) {
+	for _, value := range values {
+		fmt.Fprintf(w, "\x00%q", value)
+	}
+}
+
+// spliceable checks that the values only have letters, digits and the escapable
+// characters, anything else has to be rendered by the template
+func spliceable(values map[string]string) bool {
+	for _, value := range values {
+		for _, r := range value {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(escapable, r):
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bodyETag returns a strong etag from the contents of a page
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// inlineScriptHashes returns the content security policy hashes of the scripts
+// without a src in a page
+func inlineScriptHashes(body []byte) []string {
+	var hashes []string
+
+	seen := make(map[string]bool)
+
+	// tags are matched case insensitively, only ascii is lowered so the offsets
+	// are the same as in the body
+	lower := make([]byte, len(body))
+	for i, b := range body {
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		lower[i] = b
+	}
+
+	for offset := 0; ; {
+		start := bytes.Index(lower[offset:], []byte("<script"))
+		if start == -1 {
+			break
+		}
+		start += offset
+
+		open := bytes.IndexByte(lower[start:], '>')
+		if open == -1 {
+			break
+		}
+		open += start + 1
+
+		end := bytes.Index(lower[open:], []byte("</script"))
+		if end == -1 {
+			break
+		}
+		end += open
+
+		offset = end
+
+		// scripts with a src are allowed by source
+		if bytes.Contains(lower[start:open], []byte(" src=")) {
+			continue
+		}
+
+		sum := sha256.Sum256(body[open:end])
+		hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+
+		if !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return hashes
+}
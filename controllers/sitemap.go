@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+
+	"github.com/eirka/eirka-index/cache"
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/models"
+)
+
+// MaxSitemapURLs is the limit of urls in one sitemap file
+const MaxSitemapURLs = 50000
+
+// sitemaps caches the generated xml by imageboard, section, page and scheme. A full
+// page of 50000 urls is around 6MB so only a few are kept.
+var sitemaps = cache.New[[]byte](16, 15*time.Minute)
+
+// sitemapIndex is the root of a sitemap index file
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod,omitempty"`
+}
+
+// urlset is the root of a sitemap file
+type urlset struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapPageSize returns the configured amount of urls per page
+func sitemapPageSize() uint {
+	size := local.Settings.Sitemap.PageSize
+	if size == 0 || size > MaxSitemapURLs {
+		return MaxSitemapURLs
+	}
+	return size
+}
+
+// sitemapAllowed checks if the imageboard may have a sitemap
+func sitemapAllowed(site *local.SiteData) bool {
+	return !(site.Nsfw && local.Settings.Sitemap.ExcludeNsfw)
+}
+
+// sitemapPath returns the path of a page of a sitemap section
+func sitemapPath(site *local.SiteData, section string, page uint) string {
+	return fmt.Sprintf("/%ssitemap/%s/%d.xml", site.Base, section, page)
+}
+
+// SitemapIndexController lists the sitemap pages for the imageboard
+func SitemapIndexController(c *gin.Context) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	if !sitemapAllowed(site) {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	key := fmt.Sprintf("%d:index:%s", site.Ib, requestScheme(c))
+
+	if body, ok := sitemaps.Get(key); ok {
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+		return
+	}
+
+	m := models.SitemapIndexModel{Ib: site.Ib}
+
+	err := m.Get()
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("SitemapIndexController.Get")
+		return
+	}
+
+	index := sitemapIndex{}
+	size := sitemapPageSize()
+	origin := siteOrigin(c, c.GetString("host"))
+
+	for _, section := range m.Result {
+		pages := (section.Count + size - 1) / size
+
+		for page := uint(1); page <= pages; page++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapEntry{
+				Loc:     absoluteURL(origin, sitemapPath(site, section.Name, page)),
+				Lastmod: lastmod(section.Modified),
+			})
+		}
+	}
+
+	body, err := marshalXML(index)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("SitemapIndexController.marshalXML")
+		return
+	}
+
+	sitemaps.Set(key, body)
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+
+}
+
+// SitemapController generates a page of threads, tags or images
+func SitemapController(c *gin.Context) {
+
+	// get sitemap from session middleware
+	site := c.MustGet("sitemap").(*local.SiteData)
+
+	if !sitemapAllowed(site) {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	section := c.Param("section")
+
+	var prefix string
+
+	switch section {
+	case models.SitemapThreads:
+		prefix = "thread"
+	case models.SitemapTags:
+		prefix = "tag"
+	case models.SitemapImages:
+		prefix = "image"
+	default:
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	page, err := strconv.ParseUint(strings.TrimSuffix(c.Param("page"), ".xml"), 10, 32)
+	if err != nil || page == 0 || !strings.HasSuffix(c.Param("page"), ".xml") {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s:%d:%s", site.Ib, section, page, requestScheme(c))
+
+	if body, ok := sitemaps.Get(key); ok {
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+		return
+	}
+
+	m := models.SitemapModel{
+		Ib:      site.Ib,
+		Section: section,
+		Page:    uint(page),
+		Limit:   sitemapPageSize(),
+	}
+
+	err = m.Get()
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("SitemapController.Get")
+		return
+	}
+
+	// past the last page
+	if len(m.Result) == 0 {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	set := urlset{}
+	origin := siteOrigin(c, c.GetString("host"))
+
+	for _, item := range m.Result {
+		var path string
+
+		// threads and tags start on their first page
+		if section == models.SitemapImages {
+			path = fmt.Sprintf("/%s%s/%d", site.Base, prefix, item.ID)
+		} else {
+			path = fmt.Sprintf("/%s%s/%d/1", site.Base, prefix, item.ID)
+		}
+
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     absoluteURL(origin, path),
+			Lastmod: lastmod(item.Modified),
+		})
+	}
+
+	body, err := marshalXML(set)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("SitemapController.marshalXML")
+		return
+	}
+
+	sitemaps.Set(key, body)
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+
+}
+
+// lastmod formats a time for a sitemap, zero times are left out
+func lastmod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// marshalXML encodes v with the xml header
+func marshalXML(v interface{}) ([]byte, error) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
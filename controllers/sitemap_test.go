@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func setupSitemapRouter(site *local.SiteData) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	sitemaps.Purge()
+
+	setup := func(c *gin.Context) {
+		c.Set("host", "test.board")
+		c.Set("sitemap", site)
+	}
+
+	r.GET("/sitemap.xml", setup, SitemapIndexController)
+	r.GET("/sitemap/:section/:page", setup, SitemapController)
+
+	return r
+}
+
+func performSitemapRequest(r http.Handler, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSitemapIndex(t *testing.T) {
+	local.Settings = &local.Config{Sitemap: local.Sitemap{PageSize: 2}}
+
+	r := setupSitemapRouter(&local.SiteData{Ib: 1})
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\),MAX\(thread_last_post\) FROM threads`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(3, modified))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM tags`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\),MAX\(post_time\) FROM images`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(1, modified))
+
+	resp := performSitemapRequest(r, "/sitemap.xml")
+
+	body := resp.Body.String()
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(t, body, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, body, `<loc>http://test.board/sitemap/threads/1.xml</loc><lastmod>2020-01-02T03:04:05Z</lastmod>`)
+	assert.Contains(t, body, `<loc>http://test.board/sitemap/threads/2.xml</loc>`, "Threads should be split by the page size")
+	assert.NotContains(t, body, `sitemap/tags/`, "Empty sections should not be listed")
+	assert.Contains(t, body, `<loc>http://test.board/sitemap/images/1.xml</loc>`)
+
+	// served from the cache
+	resp = performSitemapRequest(r, "/sitemap.xml")
+	assert.Equal(t, body, resp.Body.String())
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestSitemapPage(t *testing.T) {
+	local.Settings = &local.Config{Sitemap: local.Sitemap{PageSize: 2}}
+
+	r := setupSitemapRouter(&local.SiteData{Ib: 1})
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT thread_id,thread_last_post FROM threads`).
+		WithArgs(1, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_id", "thread_last_post"}).AddRow(7, modified))
+
+	resp := performSitemapRequest(r, "/sitemap/threads/2.xml")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `<url><loc>http://test.board/thread/7/1</loc><lastmod>2020-01-02T03:04:05Z</lastmod></url>`)
+
+	mock.ExpectQuery(`SELECT images.image_id,post_time FROM images`).
+		WithArgs(1, 0, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "post_time"}))
+
+	resp = performSitemapRequest(r, "/sitemap/images/1.xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Empty pages should 404")
+
+	resp = performSitemapRequest(r, "/sitemap/posts/1.xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Unknown sections should 404")
+
+	resp = performSitemapRequest(r, "/sitemap/threads/one.xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Invalid pages should 404")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestSitemapExcludeNsfw(t *testing.T) {
+	local.Settings = &local.Config{Sitemap: local.Sitemap{ExcludeNsfw: true}}
+
+	r := setupSitemapRouter(&local.SiteData{Ib: 1, Nsfw: true})
+
+	resp := performSitemapRequest(r, "/sitemap.xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Adult boards should not have a sitemap")
+
+	resp = performSitemapRequest(r, "/sitemap/threads/1.xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Adult boards should not have a sitemap")
+}
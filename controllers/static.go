@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+
+	"github.com/eirka/eirka-index/assets"
+	"github.com/eirka/eirka-index/cache"
+	m "github.com/eirka/eirka-index/middleware"
+)
+
+// ImmutableMaxAge is how long fingerprinted files are cached
+const ImmutableMaxAge = 365 * 24 * time.Hour
+
+// etags caches the digests of the served files keyed by path, size and modification time
+var etags = cache.New[string](1000, time.Hour)
+
+// precompressed are the encoded copies looked for next to a file, in order of preference
+var precompressed = []struct {
+	coding string
+	ext    string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static serves the files in the assets directory
+type Static struct {
+	// Dir is the assets directory
+	Dir string
+	// Prim resolves the fingerprinted prim file names
+	Prim *assets.Manifest
+	// MaxAge is how long files without a fingerprint are cached
+	MaxAge time.Duration
+}
+
+// Controller serves a file from the assets directory without directory listings
+func (s *Static) Controller(c *gin.Context) {
+
+	name, ok := cleanAssetPath(c.Param("path"))
+	if !ok {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		return
+	}
+
+	immutable := false
+
+	// fingerprinted prim files are served from the real file
+	if prim, ok := strings.CutPrefix(name, "prim/"); ok {
+		if file, ok := s.Prim.Resolve(prim); ok {
+			name = "prim/" + file
+			// without fingerprints the url is the file name and can change
+			immutable = file != prim
+		}
+	}
+
+	full := filepath.Join(s.Dir, filepath.FromSlash(name))
+
+	info, err := os.Stat(full)
+	if err != nil || info.IsDir() {
+		c.JSON(e.ErrorMessage(e.ErrNotFound))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.Error(err).SetMeta("Static.Stat")
+		}
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+
+	// the encoded copies vary by the accepted encodings
+	c.Header("Vary", "Accept-Encoding")
+
+	for _, encoded := range precompressed {
+		if !m.AcceptsEncoding(c.GetHeader("Accept-Encoding"), encoded.coding) {
+			continue
+		}
+
+		encodedInfo, err := os.Stat(full + encoded.ext)
+		if err != nil || encodedInfo.IsDir() || encodedInfo.ModTime().Before(info.ModTime()) {
+			// a stale copy is ignored
+			continue
+		}
+
+		c.Header("Content-Encoding", encoded.coding)
+		full, info = full+encoded.ext, encodedInfo
+		break
+	}
+
+	// the type can not be sniffed from encoded content
+	if contentType == "" && c.Writer.Header().Get("Content-Encoding") != "" {
+		contentType = "application/octet-stream"
+	}
+
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	if immutable {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(ImmutableMaxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.MaxAge.Seconds())))
+	}
+
+	etag, err := fileETag(full, info)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("Static.fileETag")
+		return
+	}
+
+	c.Header("ETag", etag)
+
+	file, err := os.Open(full)
+	if err != nil {
+		c.JSON(e.ErrorMessage(e.ErrInternalError))
+		c.Error(err).SetMeta("Static.Open")
+		return
+	}
+	defer file.Close()
+
+	// handles range requests and the conditional headers
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+
+}
+
+// cleanAssetPath normalizes the requested path, hidden files and the template
+// includes are never served
+func cleanAssetPath(requested string) (string, bool) {
+	name := strings.TrimPrefix(path.Clean("/"+requested), "/")
+
+	if name == "" || name == "includes" || strings.HasPrefix(name, "includes/") {
+		return "", false
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+
+	return name, true
+}
+
+// fileETag returns the strong etag of a file from its contents
+func fileETag(full string, info os.FileInfo) (string, error) {
+	key := fmt.Sprintf("%s:%d:%d", full, info.Size(), info.ModTime().UnixNano())
+
+	if etag, ok := etags.Get(key); ok {
+		return etag, nil
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	etags.Set(key, etag)
+
+	return etag, nil
+}
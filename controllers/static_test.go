@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eirka/eirka-index/assets"
+)
+
+func setupStatic(t *testing.T) (*Static, string) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"prim/prim.js":          "alert(1)",
+		"prim/prim.css":         "body{}",
+		"prim/prim.css.br":      "brotli",
+		"prim/prim.css.gz":      "gzip",
+		"styles/.hidden.css":    "secret",
+		"includes/head.tmpl":    `[[define "headinclude"]][[end]]`,
+		"styles/stale.css":      "new",
+		"styles/stale.css.gz":   "old",
+		"fonts/unknown.ext":     "font",
+		"fonts/unknown.ext.gz":  "gzipped font",
+		"prim/subdir/child.txt": "child",
+	}
+
+	modified := time.Now().Add(-time.Hour)
+
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(body), 0644))
+		assert.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	// the compressed copy is older than the file
+	stale := filepath.Join(dir, "styles", "stale.css")
+	assert.NoError(t, os.Chtimes(stale, modified.Add(time.Minute), modified.Add(time.Minute)))
+
+	prim, err := assets.NewManifest(filepath.Join(dir, "prim"), true, "prim.js")
+	assert.NoError(t, err, "An error was not expected")
+
+	return &Static{Dir: dir, Prim: prim, MaxAge: time.Hour}, prim.Lookup("prim.js").URL
+}
+
+func performStaticRequest(s *Static, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	r.GET("/assets/*path", s.Controller)
+	r.HEAD("/assets/*path", s.Controller)
+
+	req, _ := http.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStaticFile(t *testing.T) {
+	s, _ := setupStatic(t)
+
+	resp := performStaticRequest(s, "GET", "/assets/prim/prim.js", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "alert(1)", resp.Body.String())
+	assert.Equal(t, "text/javascript; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=3600", resp.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+	assert.Equal(t, "bytes", resp.Header().Get("Accept-Ranges"))
+
+	etag := resp.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag, "ETag should be strong")
+
+	resp = performStaticRequest(s, "GET", "/assets/prim/prim.js", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.Code, "Matching ETag should not be modified")
+	assert.Empty(t, resp.Body.String())
+
+	resp = performStaticRequest(s, "GET", "/assets/prim/prim.js", map[string]string{"Range": "bytes=0-4"})
+	assert.Equal(t, http.StatusPartialContent, resp.Code, "Range should be served")
+	assert.Equal(t, "alert", resp.Body.String())
+	assert.Equal(t, "bytes 0-4/8", resp.Header().Get("Content-Range"))
+
+	resp = performStaticRequest(s, "HEAD", "/assets/prim/prim.js", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Body.String(), "HEAD should not send a body")
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	s, _ := setupStatic(t)
+
+	resp := performStaticRequest(s, "GET", "/assets/prim/prim.css", map[string]string{"Accept-Encoding": "gzip, deflate, br"})
+	assert.Equal(t, "brotli", resp.Body.String(), "Brotli should be preferred")
+	assert.Equal(t, "br", resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/css; charset=utf-8", resp.Header().Get("Content-Type"))
+	brotli := resp.Header().Get("ETag")
+
+	resp = performStaticRequest(s, "GET", "/assets/prim/prim.css", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", resp.Body.String())
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+	assert.NotEqual(t, brotli, resp.Header().Get("ETag"), "Encodings should have different etags")
+
+	resp = performStaticRequest(s, "GET", "/assets/prim/prim.css", map[string]string{"Accept-Encoding": "br;q=0"})
+	assert.Equal(t, "body{}", resp.Body.String(), "Refused encodings should not be used")
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+
+	resp = performStaticRequest(s, "GET", "/assets/styles/stale.css", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "new", resp.Body.String(), "Stale compressed copy should be ignored")
+
+	resp = performStaticRequest(s, "GET", "/assets/fonts/unknown.ext", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "application/octet-stream", resp.Header().Get("Content-Type"), "Encoded content should not be sniffed")
+}
+
+func TestStaticFingerprint(t *testing.T) {
+	s, fingerprinted := setupStatic(t)
+
+	resp := performStaticRequest(s, "GET", "/assets/prim/"+fingerprinted, nil)
+	assert.Equal(t, http.StatusOK, resp.Code, "Fingerprinted name should be served")
+	assert.Equal(t, "alert(1)", resp.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header().Get("Cache-Control"))
+
+	resp = performStaticRequest(s, "GET", "/assets/prim/prim.000000000000.js", nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Unknown fingerprint should not be found")
+}
+
+func TestStaticWithoutFingerprint(t *testing.T) {
+	s, _ := setupStatic(t)
+
+	prim, err := assets.NewManifest(filepath.Join(s.Dir, "prim"), false, "prim.js")
+	assert.NoError(t, err, "An error was not expected")
+
+	s.Prim = prim
+
+	resp := performStaticRequest(s, "GET", "/assets/prim/prim.js", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "alert(1)", resp.Body.String())
+	assert.Equal(t, "public, max-age=3600", resp.Header().Get("Cache-Control"), "Files without a fingerprint should not be immutable")
+}
+
+func TestStaticNotFound(t *testing.T) {
+	s, _ := setupStatic(t)
+
+	for _, path := range []string{
+		"/assets/",
+		"/assets/prim",
+		"/assets/prim/",
+		"/assets/prim/subdir",
+		"/assets/missing.css",
+		"/assets/styles/.hidden.css",
+		"/assets/includes/head.tmpl",
+		"/assets/prim/../includes/head.tmpl",
+		"/assets/%2e%2e/etc/passwd",
+	} {
+		resp := performStaticRequest(s, "GET", path, nil)
+		assert.Equal(t, http.StatusNotFound, resp.Code, "%s should not be served", path)
+	}
+}
@@ -1,103 +1,70 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"html/template"
-	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/facebookgo/grace/gracehttp"
 	"github.com/facebookgo/pidfile"
-	"github.com/gin-gonic/gin"
-
-	"github.com/eirka/eirka-libs/config"
-	"github.com/eirka/eirka-libs/csrf"
-	"github.com/eirka/eirka-libs/db"
 
+	"github.com/eirka/eirka-index/app"
 	local "github.com/eirka/eirka-index/config"
-	c "github.com/eirka/eirka-index/controllers"
-	m "github.com/eirka/eirka-index/middleware"
-	"github.com/eirka/eirka-index/templates"
 )
 
-func init() {
+var (
+	configPath  = flag.String("config", "", "path to the config file, defaults to $EIRKA_INDEX_CONFIG or /etc/pram/pram.conf")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+)
 
-	// Database connection settings
-	dbase := db.Database{
-		User:           local.Settings.Database.User,
-		Password:       local.Settings.Database.Password,
-		Proto:          local.Settings.Database.Protocol,
-		Host:           local.Settings.Database.Host,
-		Database:       local.Settings.Database.Database,
-		MaxIdle:        local.Settings.Index.DatabaseMaxIdle,
-		MaxConnections: local.Settings.Index.DatabaseMaxConnections,
-	}
+func main() {
 
-	// Set up DB connection
-	dbase.NewDb()
+	flag.Parse()
 
-	// Get limits and stuff from database
-	config.GetDatabaseSettings()
+	// load the config file and environment over the defaults
+	settings, err := local.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-}
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(settings.Redacted())
+		return
+	}
 
-func main() {
+	a, err := app.New(settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	// create pid file
 	pidfile.SetPidfilePath("/run/eirka/eirka-index.pid")
 
-	err := pidfile.Write()
+	err = pidfile.Write()
 	if err != nil {
 		panic("Could not write pid file")
 	}
 
-	// parse our template
-	t := template.Must(template.New("templates").Delims("[[", "]]").Parse(templates.Index))
-	t = template.Must(t.Parse(templates.Head))
-	t = template.Must(t.Parse(templates.Header))
-	t = template.Must(t.Parse(templates.Navmenu))
-	t = template.Must(t.Parse(templates.Angular))
-	t = template.Must(t.Parse(templates.HeadInclude)) // Add empty templates for includes
-	t = template.Must(t.Parse(templates.NavMenuInclude))
-	t = template.Must(t.ParseGlob(fmt.Sprintf("%s/includes/*.tmpl", local.Settings.Directories.AssetsDir)))
-
-	r := gin.Default()
-
-	// load template into gin
-	r.SetHTMLTemplate(t)
+	// stop being ready as soon as gracehttp starts shutting down
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	go func() {
+		<-signals
+		a.Drain()
+	}()
 
-	// use the details middleware
-	r.Use(m.Details())
-	// generates our csrf cookie
-	r.Use(csrf.Cookie())
-
-	// these routes are handled by angularjs
-	r.GET("/", c.IndexController)
-	r.GET("/page/:id", c.IndexController)
-	r.GET("/thread/:id/:page", c.IndexController)
-	r.GET("/directory", c.IndexController)
-	r.GET("/directory/:page", c.IndexController)
-	r.GET("/image/:id", c.IndexController)
-	r.GET("/tags/:page", c.IndexController)
-	r.GET("/tags", c.IndexController)
-	r.GET("/tag/:id/:page", c.IndexController)
-	r.GET("/account", c.IndexController)
-	r.GET("/trending", c.IndexController)
-	r.GET("/favorites/:page", c.IndexController)
-	r.GET("/favorites", c.IndexController)
-	r.GET("/admin", c.IndexController)
-	r.GET("/error", c.ErrorController)
-
-	// if nothing matches
-	r.NoRoute(c.ErrorController)
-
-	s := &http.Server{
-		Addr:              fmt.Sprintf("%s:%d", local.Settings.Index.Host, local.Settings.Index.Port),
-		ReadHeaderTimeout: 2 * time.Second,
-		Handler:           r,
-	}
+	// reload the template includes when they are edited
+	go a.WatchTemplates(context.Background())
 
-	err = gracehttp.Serve(s)
+	err = gracehttp.Serve(a.Servers()...)
 	if err != nil {
 		panic("Could not start server")
 	}
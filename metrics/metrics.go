@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Default is the registry exported on the metrics endpoint
+var Default = prometheus.NewRegistry()
+
+var (
+	// Requests counts the handled requests
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eirka_index_requests_total",
+		Help: "Requests handled by route, status and imageboard.",
+	}, []string{"route", "status", "ib"})
+	// RequestDuration is the time spent handling requests
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "eirka_index_request_duration_seconds",
+		Help: "Request latency by route, status and imageboard.",
+	}, []string{"route", "status", "ib"})
+	// SiteCacheHits counts requests served from the imageboard settings cache
+	SiteCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "eirka_index_site_cache_hits_total",
+		Help: "Requests served from the imageboard settings cache.",
+	})
+	// SiteCacheMisses counts requests that had to load imageboard settings
+	SiteCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "eirka_index_site_cache_misses_total",
+		Help: "Requests that loaded the imageboard settings from the database.",
+	})
+	// SiteCacheSize is the amount of cached imageboards
+	SiteCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "eirka_index_site_cache_size",
+		Help: "Imageboards in the settings cache.",
+	})
+	// QueryDuration is the time spent on database queries
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "eirka_index_db_query_duration_seconds",
+		Help: "Database query latency by query.",
+	}, []string{"query"})
+	// QueryErrors counts failed database queries
+	QueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eirka_index_db_query_errors_total",
+		Help: "Failed database queries by query.",
+	}, []string{"query"})
+	// TemplateDuration is the time spent rendering templates
+	TemplateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "eirka_index_template_render_seconds",
+		Help: "Template render time by template.",
+	}, []string{"template"})
+	// CSPReports counts the Content-Security-Policy violations sent by browsers
+	CSPReports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eirka_index_csp_reports_total",
+		Help: "Content-Security-Policy violation reports by directive.",
+	}, []string{"directive"})
+)
+
+func init() {
+	Default.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests,
+		RequestDuration,
+		SiteCacheHits,
+		SiteCacheMisses,
+		SiteCacheSize,
+		QueryDuration,
+		QueryErrors,
+		TemplateDuration,
+		CSPReports,
+	)
+}
+
+// ObserveQuery records the latency of a query and if it failed, a missing row is not a failure
+func ObserveQuery(query string, start time.Time, err error) {
+	QueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		QueryErrors.WithLabelValues(query).Inc()
+	}
+}
+
+// ObserveTemplate records the time spent rendering a template
+func ObserveTemplate(name string, start time.Time) {
+	TemplateDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
+// Handler exports the default registry in the prometheus text format
+var Handler = gin.WrapH(promhttp.HandlerFor(Default, promhttp.HandlerOpts{}))
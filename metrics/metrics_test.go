@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveQuery(t *testing.T) {
+	before := testutil.ToFloat64(QueryErrors.WithLabelValues("test_query"))
+
+	ObserveQuery("test_query", time.Now(), nil)
+	ObserveQuery("test_query", time.Now(), fmt.Errorf("database error"))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(QueryDuration, "eirka_index_db_query_duration_seconds"), "The query should be timed")
+	assert.Equal(t, before+1, testutil.ToFloat64(QueryErrors.WithLabelValues("test_query")), "Only the failed query should be counted")
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", Handler)
+
+	SiteCacheSize.Set(2)
+	Requests.WithLabelValues("/", "200", "1").Inc()
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), "# TYPE eirka_index_requests_total counter")
+	assert.Contains(t, w.Body.String(), "eirka_index_site_cache_size 2\n")
+	assert.Contains(t, w.Body.String(), "go_goroutines ", "Go runtime metrics should be exported")
+	assert.Contains(t, w.Body.String(), "process_", "Process metrics should be exported")
+}
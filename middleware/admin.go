@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	e "github.com/eirka/eirka-libs/errors"
+)
+
+// Admin checks the shared secret from a bearer Authorization header
+func Admin(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		token, bearer := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+		// an empty secret never matches
+		if !bearer || secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.JSON(e.ErrorMessage(e.ErrUnauthorized))
+			c.Error(e.ErrInvalidKey).SetMeta("Admin")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+	}
+}
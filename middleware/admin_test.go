@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func performAdminRequest(secret, header string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.Use(Admin(secret))
+	router.GET("/_admin/sitemap", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	req, _ := http.NewRequest("GET", "/_admin/sitemap", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminSecret(t *testing.T) {
+	resp := performAdminRequest("secret", "Bearer secret")
+	assert.Equal(t, http.StatusOK, resp.Code, "Correct secret should pass")
+
+	resp = performAdminRequest("secret", "Bearer wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Wrong secret should be rejected")
+
+	resp = performAdminRequest("secret", "secret")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Secret without the bearer scheme should be rejected")
+
+	resp = performAdminRequest("secret", "Basic secret")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Other schemes should be rejected")
+
+	resp = performAdminRequest("secret", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Missing secret should be rejected")
+
+	resp = performAdminRequest("", "Bearer ")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Empty secret should never match")
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// BrotliLevel is the brotli quality for responses, lower levels are larger than gzip
+// and higher levels cost too much per request, see BenchmarkIndexControllerBrotli
+const BrotliLevel = 4
+
+// compressible are the content types that are worth compressing besides text/*
+var compressible = map[string]bool{
+	"application/javascript": true,
+	"application/json":       true,
+	"application/xml":        true,
+	"application/atom+xml":   true,
+	"application/rss+xml":    true,
+	"image/svg+xml":          true,
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, BrotliLevel)
+	}}
+)
+
+// Compress encodes responses with brotli or gzip when the client accepts it.
+// Bodies smaller than minSize are sent as is since the encoding would not pay off.
+func Compress(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		accepted := c.GetHeader("Accept-Encoding")
+
+		var coding string
+
+		switch {
+		case c.Request.Method == http.MethodHead:
+		case AcceptsEncoding(accepted, "br"):
+			coding = "br"
+		case AcceptsEncoding(accepted, "gzip"):
+			coding = "gzip"
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			coding:         coding,
+			minSize:        minSize,
+		}
+
+		c.Writer = w
+
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+	}
+}
+
+// compressWriter holds back the start of the body until it knows if the
+// response is large enough to compress
+type compressWriter struct {
+	gin.ResponseWriter
+
+	// the negotiated coding, empty if the client accepts none
+	coding  string
+	minSize int
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+
+	if len(w.buf) >= w.minSize {
+		err := w.decide(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow sends the headers, the body is not compressed after that
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush sends what has been written so far
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.minSize)
+	}
+
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// write sends data to the encoder if there is one
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide sets up the encoding from the response headers and sends the held back body
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+
+	h := w.Header()
+
+	if w.eligible() {
+		// the response depends on Accept-Encoding even when it is not compressed
+		if !strings.Contains(strings.ToLower(strings.Join(h.Values("Vary"), ",")), "accept-encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+
+		if large && w.coding != "" {
+			w.startEncoder()
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := w.write(buf)
+	return err
+}
+
+// eligible checks if the response can be compressed
+func (w *compressWriter) eligible() bool {
+	h := w.Header()
+
+	switch status := w.Status(); {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusPartialContent, status == http.StatusNotModified:
+		return false
+	}
+
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	if strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+
+	mediatype, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediatype, "text/") || compressible[mediatype]
+}
+
+// startEncoder switches the response to the negotiated coding
+func (w *compressWriter) startEncoder() {
+	h := w.Header()
+
+	h.Set("Content-Encoding", w.coding)
+	h.Del("Content-Length")
+
+	// the encoded body is a different representation so a strong etag is weakened
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	switch w.coding {
+	case "br":
+		encoder := brotliWriters.Get().(*brotli.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	case "gzip":
+		encoder := gzipWriters.Get().(*gzip.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	}
+}
+
+// close sends a body that was too small to compress or finishes the encoding
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+
+	if w.encoder == nil {
+		return
+	}
+
+	w.encoder.Close()
+
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	}
+
+	w.encoder = nil
+}
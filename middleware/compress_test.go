@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var page = strings.Repeat("<p>compress me</p>\n", 200)
+
+func performCompressRequest(method, accept string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.Use(Compress(1024))
+	router.Handle(method, "/", handler)
+
+	req, _ := http.NewRequest(method, "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept-Encoding", accept)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func htmlHandler(body string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(body))
+	}
+}
+
+func decode(t *testing.T, coding string, body []byte) string {
+	var r io.Reader
+
+	switch coding {
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if !assert.NoError(t, err, "An error was not expected") {
+			return ""
+		}
+		r = gz
+	default:
+		return string(body)
+	}
+
+	decoded, err := io.ReadAll(r)
+	assert.NoError(t, err, "An error was not expected")
+	return string(decoded)
+}
+
+func TestCompress(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		coding string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"", ""},
+		{"identity", ""},
+	} {
+		resp := performCompressRequest("GET", test.accept, htmlHandler(page))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, test.coding, resp.Header().Get("Content-Encoding"), "%q should be encoded with %q", test.accept, test.coding)
+		assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"), "Response should vary by encoding")
+		assert.Equal(t, page, decode(t, test.coding, resp.Body.Bytes()), "Body should decode to the page")
+
+		if test.coding != "" {
+			assert.Less(t, resp.Body.Len(), len(page), "Body should be smaller")
+			assert.Equal(t, `W/"abc"`, resp.Header().Get("ETag"), "Compressed response should have a weak etag")
+			assert.Empty(t, resp.Header().Get("Content-Length"), "Length of the page should be removed")
+		} else {
+			assert.Equal(t, `"abc"`, resp.Header().Get("ETag"), "Uncompressed response should keep the etag")
+		}
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	resp := performCompressRequest("GET", "gzip", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		// many writes that are each below the threshold
+		for i := 0; i < 200; i++ {
+			c.Writer.WriteString(`{"compress":"me"}`)
+		}
+	})
+
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat(`{"compress":"me"}`, 200), decode(t, "gzip", resp.Body.Bytes()))
+}
+
+func TestCompressSkipped(t *testing.T) {
+	resp := performCompressRequest("GET", "br", htmlHandler("<p>small</p>"))
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "Small body should not be compressed")
+	assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"), "Small body should still vary by encoding")
+	assert.Equal(t, "<p>small</p>", resp.Body.String())
+	assert.Equal(t, `"abc"`, resp.Header().Get("ETag"))
+
+	resp = performCompressRequest("GET", "br", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(page))
+	})
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "Images should not be compressed")
+	assert.Empty(t, resp.Header().Get("Vary"), "Images should not vary by encoding")
+	assert.Equal(t, page, resp.Body.String())
+
+	resp = performCompressRequest("GET", "br", func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Vary", "Accept-Encoding")
+		c.Data(http.StatusOK, "text/css", []byte(page))
+	})
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"), "Encoded body should be untouched")
+	assert.Equal(t, page, resp.Body.String())
+
+	resp = performCompressRequest("GET", "br", func(c *gin.Context) {
+		c.Header("Cache-Control", "no-transform")
+		c.Data(http.StatusOK, "text/html", []byte(page))
+	})
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "no-transform should not be compressed")
+
+	resp = performCompressRequest("GET", "br", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.AbortWithStatus(http.StatusNotModified)
+	})
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "Not modified should not be compressed")
+	assert.Equal(t, `"abc"`, resp.Header().Get("ETag"))
+	assert.Empty(t, resp.Body.String())
+
+	resp = performCompressRequest("HEAD", "br", htmlHandler(page))
+	assert.Empty(t, resp.Header().Get("Content-Encoding"), "HEAD should not be compressed")
+}
@@ -2,8 +2,13 @@ package middleware
 
 import (
 	"database/sql"
+	"errors"
+	"log"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -11,108 +16,293 @@ import (
 	e "github.com/eirka/eirka-libs/errors"
 
 	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/metrics"
 )
 
+// DefaultSiteCacheTTL is used when the config does not set a ttl
+const DefaultSiteCacheTTL = 5 * time.Minute
+
+// SiteRetryInterval is how long a failed refresh waits before trying again
+const SiteRetryInterval = 30 * time.Second
+
+// siteEntry is a cached imageboard lookup
+type siteEntry struct {
+	data   *local.SiteData
+	loaded time.Time
+	// set while a background refresh is running
+	refreshing bool
+	// a failed refresh is not tried again before this
+	retry time.Time
+	// requests served from this host
+	hits atomic.Uint64
+}
+
+// SiteCacheEntry describes a cached imageboard for reporting
+type SiteCacheEntry struct {
+	Host    string    `json:"host"`
+	Ib      uint      `json:"ib_id"`
+	Title   string    `json:"title"`
+	Loaded  time.Time `json:"loaded"`
+	Expires time.Time `json:"expires"`
+	Stale   bool      `json:"stale"`
+	Hits    uint64    `json:"hits"`
+}
+
 var (
-	sitemap = make(map[string]*local.SiteData)
+	sitemap = make(map[string]*siteEntry)
 	mu      = new(sync.RWMutex)
+	// now is swapped out in tests to move the clock
+	now = time.Now
 )
 
+// siteCacheTTL returns how long an entry is fresh for
+func siteCacheTTL() time.Duration {
+	if local.Settings != nil && local.Settings.Index.SiteCacheTTL > 0 {
+		return time.Duration(local.Settings.Index.SiteCacheTTL) * time.Second
+	}
+	return DefaultSiteCacheTTL
+}
+
 // Details gets the imageboard settings from the request for the page handler variables
 func Details() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		// Get host and normalize it (strip port if present)
-		host := c.Request.Host
-		if hostParts := strings.Split(host, ":"); len(hostParts) > 1 {
-			host = hostParts[0]
-		}
+		host := requestHost(c)
 
 		mu.RLock()
 		// check the sitemap to see if its cached
-		site := sitemap[host]
+		entry := sitemap[host]
 		mu.RUnlock()
 
 		// if not query the database
-		if site == nil {
+		if entry == nil {
 			mu.Lock()
 			// Double-check within the write lock to prevent race
-			site = sitemap[host]
-			if site == nil {
-				sitedata := &local.SiteData{}
-
-				// Get Database handle
-				dbase, err := db.GetDb()
-				if err != nil {
-					mu.Unlock() // Make sure we unlock before aborting
-					c.JSON(e.ErrorMessage(e.ErrInternalError))
-					c.Error(err).SetMeta("Details.GetDb")
-					c.Abort()
-					return
-				}
+			entry = sitemap[host]
+			if entry == nil {
+				metrics.SiteCacheMisses.Inc()
 
-				// get the info about the imageboard
-				err = dbase.QueryRow(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = ?`, host).Scan(&sitedata.Ib, &sitedata.Title, &sitedata.Desc, &sitedata.Nsfw, &sitedata.API, &sitedata.Img, &sitedata.Style, &sitedata.Logo, &sitedata.Discord)
-				if err == sql.ErrNoRows {
+				sitedata, err := getSiteData(host)
+				if errors.Is(err, sql.ErrNoRows) {
 					mu.Unlock() // Make sure we unlock before aborting
 					c.JSON(e.ErrorMessage(e.ErrNotFound))
-					c.Error(err).SetMeta("Details.QueryRow")
+					c.Error(err).SetMeta("Details.getSiteData")
 					c.Abort()
 					return
 				} else if err != nil {
 					mu.Unlock() // Make sure we unlock before aborting
 					c.JSON(e.ErrorMessage(e.ErrInternalError))
-					c.Error(err).SetMeta("Details.QueryRow")
-					c.Abort()
-					return
-				}
-
-				// collect the links to the other imageboards for nav menu
-				rows, err := dbase.Query(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != ?`, sitedata.Ib)
-				if err != nil {
-					mu.Unlock() // Make sure we unlock before aborting
-					c.JSON(e.ErrorMessage(e.ErrInternalError))
-					c.Error(err).SetMeta("Details.Query")
+					c.Error(err).SetMeta("Details.getSiteData")
 					c.Abort()
 					return
 				}
-				defer rows.Close()
-
-				for rows.Next() {
-					ib := local.Imageboard{}
-
-					err = rows.Scan(&ib.Title, &ib.Address)
-					if err != nil {
-						mu.Unlock() // Make sure we unlock before aborting
-						c.JSON(e.ErrorMessage(e.ErrInternalError))
-						c.Error(err).SetMeta("Details.Scan")
-						c.Abort()
-						return
-					}
 
-					sitedata.Imageboards = append(sitedata.Imageboards, ib)
-				}
-				if err = rows.Err(); err != nil {
-					mu.Unlock() // Make sure we unlock before aborting
-					c.JSON(e.ErrorMessage(e.ErrInternalError))
-					c.Error(err).SetMeta("Details.Query")
-					c.Abort()
-					return
-				}
-
-				sitemap[host] = sitedata
+				storeSite(host, sitedata)
+				entry = sitemap[host]
+			} else {
+				metrics.SiteCacheHits.Inc()
 			}
 			mu.Unlock()
+		} else {
+			metrics.SiteCacheHits.Inc()
+
+			if now().Sub(entry.loaded) >= siteCacheTTL() {
+				// serve the stale data and refresh it in the background
+				refreshSite(host)
+			}
 		}
 
+		entry.hits.Add(1)
+
 		c.Set("host", host)
 
 		// set the site data for the request
 		// this is used in the controllers
-		c.Set("sitemap", sitemap[host])
+		c.Set("sitemap", entry.data)
 
 		c.Next()
 
 	}
 
 }
+
+// requestHost gets the host and normalizes it (strip port if present)
+func requestHost(c *gin.Context) string {
+	host := c.Request.Host
+	if hostParts := strings.Split(host, ":"); len(hostParts) > 1 {
+		host = hostParts[0]
+	}
+	return host
+}
+
+// refreshSite reloads an expired entry without blocking the request
+func refreshSite(host string) {
+	mu.Lock()
+	entry := sitemap[host]
+	if entry == nil || entry.refreshing || now().Sub(entry.loaded) < siteCacheTTL() || now().Before(entry.retry) {
+		mu.Unlock()
+		return
+	}
+	entry.refreshing = true
+	mu.Unlock()
+
+	go func() {
+		sitedata, err := getSiteData(host)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		entry.refreshing = false
+
+		// the entry was purged or reloaded while the query ran
+		if sitemap[host] != entry {
+			return
+		}
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// the imageboard was removed
+			delete(sitemap, host)
+			metrics.SiteCacheSize.Set(float64(len(sitemap)))
+		case err != nil:
+			// keep serving the stale data and back off so the database is not hit on every request
+			entry.retry = now().Add(SiteRetryInterval)
+			log.Printf("Details: refreshing %s: %v", host, err)
+		default:
+			storeSite(host, sitedata)
+		}
+	}()
+}
+
+// storeSite replaces the entry for a host, must be called with the write lock held
+func storeSite(host string, sitedata *local.SiteData) {
+	entry := &siteEntry{data: sitedata, loaded: now()}
+
+	// keep the hit count across reloads
+	if old := sitemap[host]; old != nil {
+		entry.hits.Store(old.hits.Load())
+	}
+
+	sitemap[host] = entry
+
+	metrics.SiteCacheSize.Set(float64(len(sitemap)))
+}
+
+// SiteCache reports what is currently cached
+func SiteCache() []SiteCacheEntry {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	ttl := siteCacheTTL()
+	current := now()
+
+	entries := make([]SiteCacheEntry, 0, len(sitemap))
+
+	for host, entry := range sitemap {
+		entries = append(entries, SiteCacheEntry{
+			Host:    host,
+			Ib:      entry.data.Ib,
+			Title:   entry.data.Title,
+			Loaded:  entry.loaded,
+			Expires: entry.loaded.Add(ttl),
+			Stale:   current.Sub(entry.loaded) >= ttl,
+			Hits:    entry.hits.Load(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+
+	return entries
+}
+
+// PurgeSite removes a host from the cache and reports if it was cached
+func PurgeSite(host string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, ok := sitemap[host]
+	delete(sitemap, host)
+
+	metrics.SiteCacheSize.Set(float64(len(sitemap)))
+
+	return ok
+}
+
+// PurgeSites empties the cache and returns how many hosts were removed
+func PurgeSites() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	count := len(sitemap)
+	sitemap = make(map[string]*siteEntry)
+
+	metrics.SiteCacheSize.Set(0)
+
+	return count
+}
+
+// ReloadSite loads a host from the database and replaces the cached entry
+func ReloadSite(host string) (*local.SiteData, error) {
+	sitedata, err := getSiteData(host)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if errors.Is(err, sql.ErrNoRows) {
+		// the imageboard does not exist anymore
+		delete(sitemap, host)
+		metrics.SiteCacheSize.Set(float64(len(sitemap)))
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	storeSite(host, sitedata)
+
+	return sitedata, nil
+}
+
+// getSiteData queries the imageboard settings for a host
+func getSiteData(host string) (sitedata *local.SiteData, err error) {
+	sitedata = &local.SiteData{}
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("site_data", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return nil, err
+	}
+
+	// get the info about the imageboard
+	err = dbase.QueryRow(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = ?`, host).Scan(&sitedata.Ib, &sitedata.Title, &sitedata.Desc, &sitedata.Nsfw, &sitedata.API, &sitedata.Img, &sitedata.Style, &sitedata.Logo, &sitedata.Discord)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect the links to the other imageboards for nav menu
+	rows, err := dbase.Query(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != ?`, sitedata.Ib)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ib := local.Imageboard{}
+
+		err = rows.Scan(&ib.Title, &ib.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		sitedata.Imageboards = append(sitedata.Imageboards, ib)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sitedata, nil
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/eirka/eirka-libs/config"
 	"github.com/eirka/eirka-libs/csrf"
@@ -47,7 +48,9 @@ func clearSiteCache() {
 	mu.Lock()
 	defer mu.Unlock()
 	// Reset the sitemap to an empty map
-	sitemap = make(map[string]*local.SiteData)
+	sitemap = make(map[string]*siteEntry)
+	// Reset the clock
+	now = time.Now
 }
 
 func setupRouter() (*gin.Engine, sqlmock.Sqlmock, error) {
@@ -217,3 +220,209 @@ func TestHostPortStripping(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
 }
+
+// expectSiteQueries mocks the two imageboard lookups with the given title
+func expectSiteQueries(mock sqlmock.Sqlmock, title string) {
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("test.board").
+		WillReturnRows(sqlmock.NewRows([]string{"ib_id", "ib_title", "ib_description", "ib_nsfw", "ib_api", "ib_img", "ib_style", "ib_logo", "ib_discord"}).
+			AddRow(1, title, "a test board", false, "http://test.board/api", "http://test.board/images", "style.css", "logo.png", ""))
+
+	mock.ExpectQuery(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != \?`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ib_title", "ib_domain"}).
+			AddRow("other board", "http://other.board"))
+}
+
+// cachedTitle returns the title currently in the cache for a host
+func cachedTitle(host string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if entry := sitemap[host]; entry != nil {
+		return entry.data.Title
+	}
+	return ""
+}
+
+func TestDetailsExpiredRefresh(t *testing.T) {
+	router, mock, err := setupRouter()
+	assert.NoError(t, err, "Setup should not error")
+	defer db.CloseDb()
+	defer clearSiteCache()
+
+	local.Settings = &local.Config{Index: local.Index{SiteCacheTTL: 60}}
+
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	expectSiteQueries(mock, "old title")
+
+	resp1 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Equal(t, 200, resp1.Code, "First request should succeed")
+	assert.Contains(t, resp1.Body.String(), "old title", "First request should load the row")
+
+	// still within the ttl so nothing is queried
+	now = func() time.Time { return start.Add(30 * time.Second) }
+	resp2 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Contains(t, resp2.Body.String(), "old title", "Fresh entry should be served from cache")
+	assert.NoError(t, mock.ExpectationsWereMet(), "No query should run before expiry")
+
+	// the row was changed in the database and the entry expires
+	expectSiteQueries(mock, "new title")
+	now = func() time.Time { return start.Add(61 * time.Second) }
+
+	// the stale entry is served while the refresh runs
+	resp3 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Equal(t, 200, resp3.Code, "Stale request should succeed")
+	assert.Contains(t, resp3.Body.String(), "old title", "Stale entry should be served without blocking")
+
+	assert.Eventually(t, func() bool {
+		return cachedTitle("test.board") == "new title"
+	}, time.Second, 5*time.Millisecond, "Background refresh should pick up the changed row")
+
+	resp4 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Contains(t, resp4.Body.String(), "new title", "Refreshed entry should be served")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestDetailsRefreshErrorKeepsStale(t *testing.T) {
+	router, mock, err := setupRouter()
+	assert.NoError(t, err, "Setup should not error")
+	defer db.CloseDb()
+	defer clearSiteCache()
+
+	local.Settings = &local.Config{Index: local.Index{SiteCacheTTL: 60}}
+
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	expectSiteQueries(mock, "old title")
+
+	resp1 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Equal(t, 200, resp1.Code, "First request should succeed")
+
+	// the refresh fails so the stale entry should stay
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("test.board").
+		WillReturnError(fmt.Errorf("database error"))
+
+	now = func() time.Time { return start.Add(2 * time.Minute) }
+
+	resp2 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Equal(t, 200, resp2.Code, "Stale request should succeed")
+
+	assert.Eventually(t, func() bool {
+		mu.RLock()
+		defer mu.RUnlock()
+		return !sitemap["test.board"].refreshing
+	}, time.Second, 5*time.Millisecond, "Refresh should finish")
+
+	assert.Equal(t, "old title", cachedTitle("test.board"), "Stale entry should be kept on error")
+
+	// right after the failure the refresh is not tried again
+	now = func() time.Time { return start.Add(2*time.Minute + time.Second) }
+
+	resp3 := performHTMLRequest(router, "GET", "/", "test.board")
+	assert.Equal(t, 200, resp3.Code, "Stale request should succeed")
+
+	mu.RLock()
+	refreshing := sitemap["test.board"].refreshing
+	mu.RUnlock()
+	assert.False(t, refreshing, "Refresh should back off after an error")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+
+	// after the retry interval the refresh runs again
+	expectSiteQueries(mock, "new title")
+
+	now = func() time.Time { return start.Add(2*time.Minute + SiteRetryInterval) }
+
+	performHTMLRequest(router, "GET", "/", "test.board")
+
+	assert.Eventually(t, func() bool {
+		return cachedTitle("test.board") == "new title"
+	}, time.Second, 5*time.Millisecond, "Refresh should be tried again after the retry interval")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestSiteCacheManagement(t *testing.T) {
+	router, mock, err := setupRouter()
+	assert.NoError(t, err, "Setup should not error")
+	defer db.CloseDb()
+	defer clearSiteCache()
+
+	expectSiteQueries(mock, "test board")
+
+	performHTMLRequest(router, "GET", "/", "test.board")
+	performHTMLRequest(router, "GET", "/", "test.board")
+
+	entries := SiteCache()
+	if assert.Len(t, entries, 1, "One host should be cached") {
+		assert.Equal(t, "test.board", entries[0].Host)
+		assert.Equal(t, uint64(2), entries[0].Hits, "Hits should be counted")
+		assert.False(t, entries[0].Stale, "Entry should be fresh")
+	}
+
+	// a reload replaces the data but keeps the hits
+	expectSiteQueries(mock, "reloaded board")
+
+	site, err := ReloadSite("test.board")
+	assert.NoError(t, err, "Reload should not error")
+	assert.Equal(t, "reloaded board", site.Title)
+	assert.Equal(t, "reloaded board", cachedTitle("test.board"))
+	assert.Equal(t, uint64(2), SiteCache()[0].Hits, "Hits should survive a reload")
+
+	assert.False(t, PurgeSite("other.board"), "Uncached host should not be purged")
+	assert.True(t, PurgeSite("test.board"), "Cached host should be purged")
+	assert.Empty(t, SiteCache(), "Cache should be empty")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestDetailsPurgeDuringRefresh(t *testing.T) {
+	router, mock, err := setupRouter()
+	assert.NoError(t, err, "Setup should not error")
+	defer db.CloseDb()
+	defer clearSiteCache()
+
+	local.Settings = &local.Config{Index: local.Index{SiteCacheTTL: 60}}
+
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	expectSiteQueries(mock, "old title")
+
+	performHTMLRequest(router, "GET", "/", "test.board")
+
+	// the refresh is still querying when the host is purged
+	mock.ExpectQuery(`SELECT ib_id,ib_title,ib_description,ib_nsfw,ib_api,ib_img,ib_style,ib_logo,ib_discord FROM imageboards WHERE ib_domain = \?`).
+		WithArgs("test.board").
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"ib_id", "ib_title", "ib_description", "ib_nsfw", "ib_api", "ib_img", "ib_style", "ib_logo", "ib_discord"}).
+			AddRow(1, "new title", "a test board", false, "http://test.board/api", "http://test.board/images", "style.css", "logo.png", ""))
+	mock.ExpectQuery(`SELECT ib_title,ib_domain FROM imageboards WHERE ib_id != \?`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ib_title", "ib_domain"}))
+
+	now = func() time.Time { return start.Add(2 * time.Minute) }
+
+	performHTMLRequest(router, "GET", "/", "test.board")
+
+	mu.RLock()
+	entry := sitemap["test.board"]
+	mu.RUnlock()
+
+	assert.True(t, PurgeSite("test.board"), "Cached host should be purged")
+
+	assert.Eventually(t, func() bool {
+		mu.RLock()
+		defer mu.RUnlock()
+		return !entry.refreshing
+	}, time.Second, 5*time.Millisecond, "Refresh should finish")
+
+	assert.Empty(t, cachedTitle("test.board"), "Refresh should not bring back a purged host")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptsEncoding checks if an Accept-Encoding header allows a content coding,
+// a coding with q=0 is refused and * matches codings that are not listed
+func AcceptsEncoding(header, coding string) bool {
+	wildcard := false
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		accepted := true
+
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			accepted = err == nil && q > 0
+		}
+
+		switch name {
+		case coding:
+			return accepted
+		case "*":
+			wildcard = accepted
+		}
+	}
+
+	return wildcard
+}
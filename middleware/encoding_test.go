@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert.True(t, AcceptsEncoding("gzip, deflate, br", "br"))
+	assert.True(t, AcceptsEncoding("gzip, deflate, br", "gzip"))
+	assert.False(t, AcceptsEncoding("gzip, deflate", "br"), "Unlisted coding should be refused")
+	assert.False(t, AcceptsEncoding("", "gzip"), "Empty header should refuse codings")
+	assert.True(t, AcceptsEncoding("GZIP;q=0.5", "gzip"), "Codings should be case insensitive")
+	assert.False(t, AcceptsEncoding("br;q=0, gzip", "br"), "Coding with q=0 should be refused")
+	assert.False(t, AcceptsEncoding("br; q=0.0", "br"), "Coding with q=0 should be refused")
+	assert.True(t, AcceptsEncoding("*", "br"), "Wildcard should match")
+	assert.False(t, AcceptsEncoding("*, br;q=0", "br"), "Listed coding should override the wildcard")
+	assert.False(t, AcceptsEncoding("*;q=0", "gzip"), "Refused wildcard should not match")
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+// header is a header name and value
+type header struct {
+	name  string
+	value string
+}
+
+// frameAncestors is the content security policy equivalent of X-Frame-Options
+var frameAncestors = map[string]string{
+	"DENY":       "'none'",
+	"SAMEORIGIN": "'self'",
+}
+
+// SecurityHeaders sets the security headers, a domain in settings.Boards gets
+// its own headers instead of the defaults
+func SecurityHeaders(settings local.Headers) gin.HandlerFunc {
+	defaults := securityHeaders(settings)
+
+	boards := make(map[string][]header, len(settings.Boards))
+	for domain, headers := range settings.Boards {
+		boards[domain] = securityHeaders(headers)
+	}
+
+	return func(c *gin.Context) {
+
+		headers, ok := boards[requestHost(c)]
+		if !ok {
+			headers = defaults
+		}
+
+		h := c.Writer.Header()
+
+		for _, header := range headers {
+			// frame-ancestors is enforced along with the page policy
+			h.Add(header.name, header.value)
+		}
+
+		c.Next()
+
+	}
+}
+
+// securityHeaders builds the header list from the settings
+func securityHeaders(settings local.Headers) []header {
+	var headers []header
+
+	if settings.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatUint(uint64(settings.HSTSMaxAge), 10)
+		if settings.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if settings.HSTSPreload {
+			hsts += "; preload"
+		}
+		headers = append(headers, header{"Strict-Transport-Security", hsts})
+	}
+
+	if settings.NoSniff {
+		headers = append(headers, header{"X-Content-Type-Options", "nosniff"})
+	}
+
+	if settings.ReferrerPolicy != "" {
+		headers = append(headers, header{"Referrer-Policy", settings.ReferrerPolicy})
+	}
+
+	if settings.PermissionsPolicy != "" {
+		headers = append(headers, header{"Permissions-Policy", settings.PermissionsPolicy})
+	}
+
+	if ancestors, ok := frameAncestors[settings.FrameOptions]; ok {
+		headers = append(headers,
+			header{"X-Frame-Options", settings.FrameOptions},
+			header{"Content-Security-Policy", "frame-ancestors " + ancestors},
+		)
+	}
+
+	return headers
+}
+
+// ErrorHeaders adjusts the security headers for an error page, the requested
+// url is not leaked to other sites and the page is not indexed
+func ErrorHeaders(c *gin.Context) {
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex")
+}
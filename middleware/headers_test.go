@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	local "github.com/eirka/eirka-index/config"
+)
+
+func performHeadersRequest(settings local.Headers, host string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.Use(SecurityHeaders(settings))
+	router.GET("/", handler)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Host = host
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	settings := local.Defaults().Index.Headers
+	settings.Boards = map[string]local.Headers{
+		"embed.board": {
+			HSTSMaxAge:            63072000,
+			HSTSIncludeSubdomains: true,
+			HSTSPreload:           true,
+			NoSniff:               true,
+		},
+		"strict.board": {
+			NoSniff:        true,
+			ReferrerPolicy: "no-referrer",
+			FrameOptions:   "DENY",
+		},
+	}
+
+	ok := func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	}
+
+	resp := performHeadersRequest(settings, "test.board:5005", ok)
+	assert.Equal(t, "max-age=15552000", resp.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", resp.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=(), payment=()", resp.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "SAMEORIGIN", resp.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "frame-ancestors 'self'", resp.Header().Get("Content-Security-Policy"))
+
+	resp = performHeadersRequest(settings, "embed.board", ok)
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", resp.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, resp.Header().Get("Referrer-Policy"), "Board headers should replace the defaults")
+	assert.Empty(t, resp.Header().Get("Permissions-Policy"), "Board headers should replace the defaults")
+	assert.Empty(t, resp.Header().Get("X-Frame-Options"), "Board should be allowed in frames")
+	assert.Empty(t, resp.Header().Get("Content-Security-Policy"), "Board should be allowed in frames")
+
+	resp = performHeadersRequest(settings, "strict.board", ok)
+	assert.Empty(t, resp.Header().Get("Strict-Transport-Security"), "HSTS should be disabled without a max-age")
+	assert.Equal(t, "no-referrer", resp.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "DENY", resp.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "frame-ancestors 'none'", resp.Header().Get("Content-Security-Policy"))
+
+	resp = performHeadersRequest(local.Headers{}, "test.board", ok)
+	for _, name := range []string{"Strict-Transport-Security", "X-Content-Type-Options", "Referrer-Policy", "Permissions-Policy", "X-Frame-Options", "Content-Security-Policy"} {
+		assert.Empty(t, resp.Header().Get(name), "No headers should be sent without settings")
+	}
+}
+
+func TestErrorHeaders(t *testing.T) {
+	resp := performHeadersRequest(local.Defaults().Index.Headers, "test.board", func(c *gin.Context) {
+		ErrorHeaders(c)
+		c.String(http.StatusNotFound, "not found")
+	})
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "no-referrer", resp.Header().Get("Referrer-Policy"), "Error pages should not leak the url")
+	assert.Equal(t, "noindex", resp.Header().Get("X-Robots-Tag"), "Error pages should not be indexed")
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"), "Other headers should be kept")
+	assert.Equal(t, "SAMEORIGIN", resp.Header().Get("X-Frame-Options"), "Other headers should be kept")
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	local "github.com/eirka/eirka-index/config"
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// Metrics records the request count and latency by route, status and imageboard
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+
+		c.Next()
+
+		// use the route pattern so ids dont create new series
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := strconv.Itoa(c.Writer.Status())
+
+		var ib string
+		if site, ok := c.Get("sitemap"); ok {
+			ib = strconv.FormatUint(uint64(site.(*local.SiteData).Ib), 10)
+		}
+
+		metrics.Requests.WithLabelValues(route, status, ib).Inc()
+		metrics.RequestDuration.WithLabelValues(route, status, ib).Observe(time.Since(start).Seconds())
+
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	clearSiteCache()
+
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+	defer clearSiteCache()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.Use(Details())
+	router.GET("/thread/:id/:page", SimpleHandler)
+
+	hits := testutil.ToFloat64(metrics.SiteCacheHits)
+	misses := testutil.ToFloat64(metrics.SiteCacheMisses)
+	before := testutil.ToFloat64(metrics.Requests.WithLabelValues("/thread/:id/:page", "200", "1"))
+	unmatched := testutil.ToFloat64(metrics.Requests.WithLabelValues("unmatched", "404", "1"))
+
+	expectSiteQueries(mock, "test board")
+
+	performHTMLRequest(router, "GET", "/thread/1/1", "test.board")
+	performHTMLRequest(router, "GET", "/thread/2/1", "test.board")
+	performHTMLRequest(router, "GET", "/nothing", "test.board")
+
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.Requests.WithLabelValues("/thread/:id/:page", "200", "1")), "Requests should be counted by route pattern")
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.Requests.WithLabelValues("unmatched", "404", "1")), "Unmatched routes should share a series")
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.SiteCacheMisses), "First request should miss the cache")
+	assert.Equal(t, hits+2, testutil.ToFloat64(metrics.SiteCacheHits), "Later requests should hit the cache")
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SiteCacheSize), "One imageboard should be cached")
+	assert.NotZero(t, testutil.CollectAndCount(metrics.QueryDuration, "eirka_index_db_query_duration_seconds"), "The site query should be timed")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
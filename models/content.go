@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// the kinds of content a page can show
+const (
+	ContentThread = "thread"
+	ContentTag    = "tag"
+	ContentImage  = "image"
+)
+
+// ContentModel holds the parameters for an existence check
+type ContentModel struct {
+	Ib      uint
+	Kind    string
+	ID      uint
+	Deleted bool
+}
+
+// Get checks that the content belongs to the imageboard and if it was deleted,
+// it returns sql.ErrNoRows when the content does not exist
+func (m *ContentModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery(m.Kind+"_content", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	switch m.Kind {
+	case ContentThread:
+		err = dbase.QueryRow(`SELECT thread_deleted = 1 FROM threads WHERE thread_id = ? AND ib_id = ?`,
+			m.ID, m.Ib).Scan(&m.Deleted)
+	case ContentTag:
+		// tags are removed instead of marked
+		err = dbase.QueryRow(`SELECT 0 FROM tags WHERE tag_id = ? AND ib_id = ?`,
+			m.ID, m.Ib).Scan(&m.Deleted)
+	case ContentImage:
+		err = dbase.QueryRow(`SELECT thread_deleted = 1 OR post_deleted = 1 FROM images
+	INNER JOIN posts ON images.post_id = posts.post_id
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	WHERE images.image_id = ? AND threads.ib_id = ?`, m.ID, m.Ib).Scan(&m.Deleted)
+	default:
+		err = fmt.Errorf("unknown content kind %q", m.Kind)
+	}
+
+	return
+}
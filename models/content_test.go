@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestContentDeleted(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_deleted = 1 FROM threads WHERE thread_id = \? AND ib_id = \?`).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"deleted"}).AddRow(true))
+
+	m := ContentModel{Ib: 1, Kind: ContentThread, ID: 10}
+
+	assert.NoError(t, m.Get(), "An error was not expected")
+	assert.True(t, m.Deleted, "Thread should be deleted")
+
+	mock.ExpectQuery(`SELECT thread_deleted = 1 OR post_deleted = 1 FROM images`).
+		WithArgs(5, 1).
+		WillReturnError(sql.ErrNoRows)
+
+	m = ContentModel{Ib: 1, Kind: ContentImage, ID: 5}
+
+	assert.Equal(t, sql.ErrNoRows, m.Get(), "Missing image should return no rows")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
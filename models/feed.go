@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// FeedItem is an entry in a feed, the ID is a thread for thread feeds and an image for tag feeds
+type FeedItem struct {
+	ID        uint
+	Title     string
+	Excerpt   string
+	Thumbnail string
+	Updated   time.Time
+}
+
+// ThreadFeedModel holds the parameters for the latest threads feed
+type ThreadFeedModel struct {
+	Ib     uint
+	Limit  uint
+	Result []FeedItem
+}
+
+// Get the most recently bumped threads with their first post
+func (m *ThreadFeedModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("thread_feed", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	rows, err := dbase.Query(`SELECT threads.thread_id,thread_title,COALESCE(post_text,''),COALESCE(image_thumbnail,''),thread_last_post FROM threads
+	INNER JOIN posts ON threads.thread_id = posts.thread_id AND post_num = 1
+	LEFT JOIN images ON posts.post_id = images.post_id
+	WHERE threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY thread_last_post DESC LIMIT ?`, m.Ib, m.Limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item FeedItem
+		var text string
+
+		err = rows.Scan(&item.ID, &item.Title, &text, &item.Thumbnail, &item.Updated)
+		if err != nil {
+			return
+		}
+
+		item.Excerpt = Excerpt(text, ExcerptLength)
+
+		m.Result = append(m.Result, item)
+	}
+
+	return rows.Err()
+}
+
+// TagFeedModel holds the parameters for the latest images in a tag
+type TagFeedModel struct {
+	Ib     uint
+	Tag    uint
+	Limit  uint
+	Name   string
+	Result []FeedItem
+}
+
+// Get the tag name and the most recently posted images with it
+func (m *TagFeedModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("tag_feed", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	err = dbase.QueryRow(`SELECT tag_name FROM tags WHERE tag_id = ? AND ib_id = ?`, m.Tag, m.Ib).Scan(&m.Name)
+	if err != nil {
+		return
+	}
+
+	rows, err := dbase.Query(`SELECT images.image_id,thread_title,COALESCE(post_text,''),image_thumbnail,post_time FROM tagmap
+	INNER JOIN images ON tagmap.image_id = images.image_id
+	INNER JOIN posts ON images.post_id = posts.post_id
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	WHERE tagmap.tag_id = ? AND threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY post_time DESC LIMIT ?`, m.Tag, m.Ib, m.Limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item FeedItem
+		var text string
+
+		err = rows.Scan(&item.ID, &item.Title, &text, &item.Thumbnail, &item.Updated)
+		if err != nil {
+			return
+		}
+
+		item.Excerpt = Excerpt(text, ExcerptLength)
+
+		m.Result = append(m.Result, item)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// NoscriptTextLength is the max amount of characters of a post shown without javascript
+const NoscriptTextLength = 1000
+
+// NoscriptItem is a post or thread shown to clients without javascript
+type NoscriptItem struct {
+	// ID is the post number in a thread or the thread id on an index page
+	ID        uint
+	Title     string
+	Text      string
+	Thumbnail string
+	Time      time.Time
+}
+
+// NoscriptThreadModel holds the parameters for a page of posts in a thread
+type NoscriptThreadModel struct {
+	Ib     uint
+	Thread uint
+	Page   uint
+	// PerPage is the page size of the frontend, only the first Limit posts are returned
+	PerPage uint
+	Limit   uint
+	Result  []NoscriptItem
+}
+
+// Get the posts on a page of the thread with their thumbnails
+func (m *NoscriptThreadModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("noscript_thread", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	rows, err := dbase.Query(`SELECT post_num,COALESCE(post_text,''),COALESCE(image_thumbnail,''),post_time FROM posts
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	LEFT JOIN images ON posts.post_id = images.post_id
+	WHERE threads.thread_id = ? AND threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY post_num ASC LIMIT ? OFFSET ?`, m.Thread, m.Ib, m.Limit, (m.Page-1)*m.PerPage)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item NoscriptItem
+		var text string
+
+		err = rows.Scan(&item.ID, &text, &item.Thumbnail, &item.Time)
+		if err != nil {
+			return
+		}
+
+		item.Text = Excerpt(text, NoscriptTextLength)
+
+		m.Result = append(m.Result, item)
+	}
+
+	return rows.Err()
+}
+
+// NoscriptIndexModel holds the parameters for a page of the thread index
+type NoscriptIndexModel struct {
+	Ib   uint
+	Page uint
+	// PerPage is the page size of the frontend, only the first Limit threads are returned
+	PerPage uint
+	Limit   uint
+	Result  []NoscriptItem
+}
+
+// Get the most recently bumped threads on a page with their first post
+func (m *NoscriptIndexModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("noscript_index", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	rows, err := dbase.Query(`SELECT threads.thread_id,thread_title,COALESCE(post_text,''),COALESCE(image_thumbnail,''),thread_last_post FROM threads
+	INNER JOIN posts ON threads.thread_id = posts.thread_id AND post_num = 1
+	LEFT JOIN images ON posts.post_id = images.post_id
+	WHERE threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY thread_last_post DESC LIMIT ? OFFSET ?`, m.Ib, m.Limit, (m.Page-1)*m.PerPage)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item NoscriptItem
+		var text string
+
+		err = rows.Scan(&item.ID, &item.Title, &text, &item.Thumbnail, &item.Time)
+		if err != nil {
+			return
+		}
+
+		item.Text = Excerpt(text, NoscriptTextLength)
+
+		m.Result = append(m.Result, item)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestNoscriptThread(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	posted := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT post_num,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\),post_time FROM posts`).
+		WithArgs(10, 1, 40, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"post_num", "post_text", "image_thumbnail", "post_time"}).
+			AddRow(41, "a reply", "123s.jpg", posted).
+			AddRow(42, strings.Repeat("long ", 500), "", posted))
+
+	// the second page of 100 posts starts at 100 even if fewer are shown
+	m := NoscriptThreadModel{Ib: 1, Thread: 10, Page: 2, PerPage: 100, Limit: 40}
+
+	assert.NoError(t, m.Get(), "An error was not expected")
+	if assert.Len(t, m.Result, 2) {
+		assert.Equal(t, NoscriptItem{ID: 41, Text: "a reply", Thumbnail: "123s.jpg", Time: posted}, m.Result[0])
+		assert.LessOrEqual(t, len([]rune(m.Result[1].Text)), NoscriptTextLength+1, "Long posts should be cut")
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
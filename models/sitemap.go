@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// the sitemap sections
+const (
+	SitemapThreads = "threads"
+	SitemapTags    = "tags"
+	SitemapImages  = "images"
+)
+
+// SitemapSections are the sections in the order they are listed
+var SitemapSections = []string{SitemapThreads, SitemapTags, SitemapImages}
+
+// SitemapSection holds the size of a sitemap section
+type SitemapSection struct {
+	Name     string
+	Count    uint
+	Modified time.Time
+}
+
+// SitemapURL is an item in a sitemap section
+type SitemapURL struct {
+	ID       uint
+	Modified time.Time
+}
+
+// SitemapIndexModel holds the parameters for the sitemap index
+type SitemapIndexModel struct {
+	Ib     uint
+	Result []SitemapSection
+}
+
+// Get the amount of items and last modification of every section
+func (m *SitemapIndexModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("sitemap_index", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	var modified sql.NullTime
+
+	threads := SitemapSection{Name: SitemapThreads}
+
+	err = dbase.QueryRow(`SELECT COUNT(*),MAX(thread_last_post) FROM threads
+	WHERE ib_id = ? AND thread_deleted != 1`, m.Ib).Scan(&threads.Count, &modified)
+	if err != nil {
+		return
+	}
+	threads.Modified = modified.Time
+
+	tags := SitemapSection{Name: SitemapTags}
+
+	err = dbase.QueryRow(`SELECT COUNT(*) FROM tags WHERE ib_id = ?`, m.Ib).Scan(&tags.Count)
+	if err != nil {
+		return
+	}
+
+	images := SitemapSection{Name: SitemapImages}
+
+	err = dbase.QueryRow(`SELECT COUNT(*),MAX(post_time) FROM images
+	INNER JOIN posts ON images.post_id = posts.post_id
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	WHERE threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1`, m.Ib).Scan(&images.Count, &modified)
+	if err != nil {
+		return
+	}
+	images.Modified = modified.Time
+
+	m.Result = []SitemapSection{threads, tags, images}
+
+	return
+}
+
+// SitemapModel holds the parameters for a page of a sitemap section
+type SitemapModel struct {
+	Ib      uint
+	Section string
+	Page    uint
+	Limit   uint
+	Result  []SitemapURL
+}
+
+// Get a page of items from a sitemap section
+func (m *SitemapModel) Get() (err error) {
+
+	var query string
+
+	switch m.Section {
+	case SitemapThreads:
+		query = `SELECT thread_id,thread_last_post FROM threads
+	WHERE ib_id = ? AND thread_deleted != 1
+	ORDER BY thread_id ASC LIMIT ?,?`
+	case SitemapTags:
+		query = `SELECT tags.tag_id,MAX(post_time) FROM tags
+	LEFT JOIN tagmap ON tags.tag_id = tagmap.tag_id
+	LEFT JOIN images ON tagmap.image_id = images.image_id
+	LEFT JOIN posts ON images.post_id = posts.post_id
+	WHERE tags.ib_id = ?
+	GROUP BY tags.tag_id
+	ORDER BY tags.tag_id ASC LIMIT ?,?`
+	case SitemapImages:
+		query = `SELECT images.image_id,post_time FROM images
+	INNER JOIN posts ON images.post_id = posts.post_id
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	WHERE threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY images.image_id ASC LIMIT ?,?`
+	default:
+		return fmt.Errorf("unknown sitemap section %s", m.Section)
+	}
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("sitemap_"+m.Section, start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	rows, err := dbase.Query(query, m.Ib, (m.Page-1)*m.Limit, m.Limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item SitemapURL
+		var modified sql.NullTime
+
+		err = rows.Scan(&item.ID, &modified)
+		if err != nil {
+			return
+		}
+
+		item.Modified = modified.Time
+
+		m.Result = append(m.Result, item)
+	}
+
+	return rows.Err()
+}
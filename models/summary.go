@@ -0,0 +1,132 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eirka/eirka-libs/db"
+
+	"github.com/eirka/eirka-index/metrics"
+)
+
+// ExcerptLength is the max amount of characters in a post excerpt
+const ExcerptLength = 200
+
+// Summary holds the preview information of a thread or image
+type Summary struct {
+	Title     string
+	Excerpt   string
+	Thumbnail string
+}
+
+// ThreadSummaryModel holds the parameters for a thread lookup
+type ThreadSummaryModel struct {
+	Ib     uint
+	Thread uint
+	Result Summary
+}
+
+// Get the thread title with its first post and thumbnail
+func (m *ThreadSummaryModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("thread_summary", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	var text string
+
+	err = dbase.QueryRow(`SELECT thread_title,COALESCE(post_text,''),COALESCE(image_thumbnail,'') FROM threads
+	INNER JOIN posts ON threads.thread_id = posts.thread_id
+	LEFT JOIN images ON posts.post_id = images.post_id
+	WHERE threads.thread_id = ? AND threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1
+	ORDER BY post_num ASC LIMIT 1`, m.Thread, m.Ib).Scan(&m.Result.Title, &text, &m.Result.Thumbnail)
+	if err != nil {
+		return
+	}
+
+	m.Result.Excerpt = Excerpt(text, ExcerptLength)
+
+	return
+}
+
+// ImageSummaryModel holds the parameters for an image lookup
+type ImageSummaryModel struct {
+	Ib     uint
+	Image  uint
+	Result Summary
+}
+
+// Get the image thumbnail with the post and thread it belongs to
+func (m *ImageSummaryModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("image_summary", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	var text string
+
+	err = dbase.QueryRow(`SELECT thread_title,COALESCE(post_text,''),image_thumbnail FROM images
+	INNER JOIN posts ON images.post_id = posts.post_id
+	INNER JOIN threads ON posts.thread_id = threads.thread_id
+	WHERE images.image_id = ? AND threads.ib_id = ? AND thread_deleted != 1 AND post_deleted != 1`, m.Image, m.Ib).Scan(&m.Result.Title, &text, &m.Result.Thumbnail)
+	if err != nil {
+		return
+	}
+
+	m.Result.Excerpt = Excerpt(text, ExcerptLength)
+
+	return
+}
+
+// TagSummaryModel holds the parameters for a tag lookup
+type TagSummaryModel struct {
+	Ib     uint
+	Tag    uint
+	Result Summary
+}
+
+// Get the tag name
+func (m *TagSummaryModel) Get() (err error) {
+
+	start := time.Now()
+	defer func() { metrics.ObserveQuery("tag_summary", start, err) }()
+
+	// Get Database handle
+	dbase, err := db.GetDb()
+	if err != nil {
+		return
+	}
+
+	err = dbase.QueryRow(`SELECT tag_name FROM tags WHERE tag_id = ? AND ib_id = ?`, m.Tag, m.Ib).Scan(&m.Result.Title)
+
+	return
+}
+
+// Excerpt collapses the whitespace in text and shortens it to length characters
+func Excerpt(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+
+	runes := []rune(text)[:length]
+
+	// try to cut on a word boundary
+	if i := strings.LastIndex(string(runes), " "); i > length/2 {
+		return string(runes)[:i] + "…"
+	}
+
+	return string(runes) + "…"
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/eirka/eirka-libs/db"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestThreadSummary(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),COALESCE\(image_thumbnail,''\) FROM threads`).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"thread_title", "post_text", "image_thumbnail"}).
+			AddRow("a thread", "first\n\npost", "123s.jpg"))
+
+	m := ThreadSummaryModel{Ib: 1, Thread: 10}
+
+	assert.NoError(t, m.Get(), "An error was not expected")
+	assert.Equal(t, Summary{Title: "a thread", Excerpt: "first post", Thumbnail: "123s.jpg"}, m.Result)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestImageSummaryNotFound(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT thread_title,COALESCE\(post_text,''\),image_thumbnail FROM images`).
+		WithArgs(5, 1).
+		WillReturnError(sql.ErrNoRows)
+
+	m := ImageSummaryModel{Ib: 1, Image: 5}
+
+	assert.Equal(t, sql.ErrNoRows, m.Get(), "Missing image should return no rows")
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestTagSummary(t *testing.T) {
+	mock, err := db.NewTestDb()
+	assert.NoError(t, err, "An error was not expected")
+	defer db.CloseDb()
+
+	mock.ExpectQuery(`SELECT tag_name FROM tags WHERE tag_id = \? AND ib_id = \?`).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"tag_name"}).AddRow("landscape"))
+
+	m := TagSummaryModel{Ib: 1, Tag: 3}
+
+	assert.NoError(t, m.Get(), "An error was not expected")
+	assert.Equal(t, Summary{Title: "landscape"}, m.Result)
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "An error was not expected")
+}
+
+func TestExcerpt(t *testing.T) {
+	assert.Equal(t, "short text", Excerpt("  short\ttext ", 20))
+
+	long := strings.Repeat("word ", 20)
+	excerpt := Excerpt(long, 22)
+	assert.Equal(t, "word word word word…", excerpt, "Excerpt should cut on a word boundary")
+
+	assert.Equal(t, "abcde…", Excerpt("abcdefghij", 5), "Excerpt should cut long words")
+}
@@ -0,0 +1,280 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Renderer is a gin HTMLRender whose template set can be reloaded while serving
+type Renderer struct {
+	assetsDir  string
+	current    atomic.Pointer[Set]
+	generation atomic.Uint64
+	// serializes reloads and guards files
+	mu sync.Mutex
+	// the include files seen by the last reload
+	files map[string]fileState
+}
+
+// fileState is what the watcher compares to detect changes
+type fileState struct {
+	modified time.Time
+	size     int64
+}
+
+// NewRenderer parses the templates with the includes from the assets directory
+func NewRenderer(assetsDir string) (*Renderer, error) {
+	r := &Renderer{assetsDir: assetsDir}
+
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Instance implements render.HTMLRender with the current template set. The
+// controllers pass the imageboard id as "ib" which selects its overrides.
+func (r *Renderer) Instance(name string, data interface{}) render.Render {
+	return render.HTML{
+		Template: r.current.Load().Lookup(dataIb(data)),
+		Name:     name,
+		Data:     data,
+	}
+}
+
+// Template returns the current global template set
+func (r *Renderer) Template() *template.Template {
+	return r.current.Load().Global
+}
+
+// dataIb gets the imageboard id from the template data
+func dataIb(data interface{}) uint {
+	var ib interface{}
+
+	switch d := data.(type) {
+	case gin.H:
+		ib = d["ib"]
+	case map[string]interface{}:
+		ib = d["ib"]
+	}
+
+	id, _ := ib.(uint)
+
+	return id
+}
+
+// Generation is increased every time the template set is replaced
+func (r *Renderer) Generation() uint64 {
+	return r.generation.Load()
+}
+
+// Reload parses the templates and swaps them in if they render the index page,
+// the current set is kept if anything fails
+func (r *Renderer) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.scan()
+	if err != nil {
+		return err
+	}
+
+	set, err := LoadSet(r.assetsDir)
+	if err != nil {
+		return err
+	}
+
+	err = Validate(set.Global)
+	if err != nil {
+		return err
+	}
+
+	for ib, t := range set.Boards {
+		err = Validate(t)
+		if err != nil {
+			return fmt.Errorf("imageboard %d: %w", ib, err)
+		}
+	}
+
+	r.current.Store(set)
+	r.generation.Add(1)
+	r.files = files
+
+	return nil
+}
+
+// Watch polls the includes directory and reloads the templates when a file
+// changes until ctx is cancelled
+func (r *Renderer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.changed()
+		if err != nil {
+			log.Printf("templates: scanning includes: %v", err)
+			continue
+		}
+
+		if len(changed) == 0 {
+			continue
+		}
+
+		err = r.Reload()
+		if err != nil {
+			log.Printf("templates: keeping current templates, reload failed after %s changed: %v", strings.Join(changed, ", "), err)
+			continue
+		}
+
+		log.Printf("templates: reloaded after %s changed", strings.Join(changed, ", "))
+	}
+}
+
+// changed lists the include files that were added, removed or modified since the last reload
+func (r *Renderer) changed() ([]string, error) {
+	files, err := r.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []string
+
+	for name, state := range files {
+		if old, ok := r.files[name]; !ok || old != state {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range r.files {
+		if _, ok := files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// scan stats the include files
+func (r *Renderer) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+
+	dir := filepath.Join(r.assetsDir, "includes")
+
+	includes, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the imageboard overrides
+	boards, err := filepath.Glob(filepath.Join(dir, "*", "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	includes = append(includes, boards...)
+
+	for _, path := range includes {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed since the glob
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		name, _ := filepath.Rel(dir, path)
+		files[name] = fileState{modified: info.ModTime(), size: info.Size()}
+	}
+
+	return files, nil
+}
+
+// SampleData is a page like the controllers render, used to validate templates
+func SampleData() map[string]interface{} {
+	return map[string]interface{}{
+		"primjs":                "prim.js",
+		"primjs_integrity":      "sha384-sample",
+		"primcss":               "prim.css",
+		"primcss_integrity":     "sha384-sample",
+		"fontawesome":           "https://example.com/font-awesome.css",
+		"fontawesome_integrity": "sha384-sample",
+		"ib":                    uint(1),
+		"base":                  "",
+		"apisrv":                "api.example.com",
+		"imgsrv":                "img.example.com",
+		"title":                 "Sample",
+		"desc":                  "Sample imageboard",
+		"nsfw":                  false,
+		"style":                 "sample.css",
+		"logo":                  "sample.png",
+		"discord":               "",
+		"imageboards":           []map[string]string{{"Title": "Other", "Address": "other.example.com"}},
+		"csrf":                  "sample-csrf-token",
+		"nonce":                 "sample-nonce",
+		"cacheable":             false,
+		"canonical":             "https://example.com/page/2",
+		"prev":                  "https://example.com/",
+		"next":                  "https://example.com/page/3",
+		"page_title":            "Page 2 - Sample",
+		"page_desc":             "Page 2 of Sample",
+		"robots":                "noindex",
+		"noscript": map[string]interface{}{
+			"Items": []map[string]string{
+				{"Link": "/thread/1/1", "Title": "Sample thread", "Text": "Sample post", "Thumbnail": "https://img.example.com/thumb/1.jpg"},
+			},
+		},
+		"error": map[string]interface{}{"status": 404, "code": "not_found", "message": "Not Found"},
+		"og": map[string]string{
+			"Site":  "Sample",
+			"Title": "Sample",
+			"Desc":  "Sample imageboard",
+			"Image": "https://example.com/assets/logo/sample.png",
+			"URL":   "https://example.com/",
+			"Card":  "summary",
+		},
+	}
+}
+
+// Validate renders the index template with sample data
+func Validate(t *template.Template) error {
+	if t.Lookup("index") == nil {
+		return errors.New("index template is not defined")
+	}
+
+	var buf bytes.Buffer
+
+	err := t.ExecuteTemplate(&buf, "index", SampleData())
+	if err != nil {
+		return fmt.Errorf("rendering index: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/render"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderInclude renders the head include of the current template set
+func renderInclude(r *Renderer) string {
+	var buf bytes.Buffer
+	r.Template().ExecuteTemplate(&buf, "headinclude", nil)
+	return buf.String()
+}
+
+func writeInclude(t *testing.T, assets, name, body string, modified time.Time) {
+	path := filepath.Join(assets, "includes", name)
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0644))
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func TestRendererReload(t *testing.T) {
+	assets := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(assets, "includes"), 0755))
+
+	start := time.Now().Add(-time.Hour)
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]]one[[end]]`, start)
+
+	r, err := NewRenderer(assets)
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, "one", renderInclude(r))
+	assert.Equal(t, uint64(1), r.Generation())
+
+	changed, err := r.changed()
+	assert.NoError(t, err, "An error was not expected")
+	assert.Empty(t, changed, "Nothing should have changed")
+
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]]two[[end]]`, start.Add(time.Minute))
+	writeInclude(t, assets, "nav.tmpl", `[[define "navmenuinclude"]][[end]]`, start)
+
+	changed, err = r.changed()
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, []string{"head.tmpl", "nav.tmpl"}, changed, "Modified and added files should be reported")
+
+	assert.NoError(t, r.Reload(), "Reload should succeed")
+	assert.Equal(t, "two", renderInclude(r), "Reload should swap in the new include")
+	assert.Equal(t, uint64(2), r.Generation())
+
+	// a broken include keeps the current set
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]][[ template "nonexistent" ]][[end]]`, start.Add(2*time.Minute))
+
+	assert.Error(t, r.Reload(), "Include that cant render the index should fail")
+	assert.Equal(t, "two", renderInclude(r), "Failed reload should keep the current templates")
+	assert.Equal(t, uint64(2), r.Generation())
+}
+
+func TestRendererWatch(t *testing.T) {
+	assets := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(assets, "includes"), 0755))
+
+	start := time.Now().Add(-time.Hour)
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]]one[[end]]`, start)
+
+	r, err := NewRenderer(assets)
+	assert.NoError(t, err, "An error was not expected")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go r.Watch(ctx, 5*time.Millisecond)
+
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]]two[[end]]`, start.Add(time.Minute))
+
+	assert.Eventually(t, func() bool {
+		return renderInclude(r) == "two"
+	}, time.Second, 5*time.Millisecond, "Watcher should reload the changed include")
+}
+
+func TestValidate(t *testing.T) {
+	tmpl, err := Load(t.TempDir())
+	assert.NoError(t, err, "An error was not expected")
+	assert.NoError(t, Validate(tmpl), "Default templates should render the sample data")
+}
+
+func TestRendererBoardOverrides(t *testing.T) {
+	assets := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(assets, "includes", "2"), 0755))
+	// not an imageboard id so its ignored
+	assert.NoError(t, os.MkdirAll(filepath.Join(assets, "includes", "partials"), 0755))
+
+	start := time.Now().Add(-time.Hour)
+	writeInclude(t, assets, "head.tmpl", `[[define "headinclude"]]global[[end]]`, start)
+	writeInclude(t, assets, "nav.tmpl", `[[define "navmenuinclude"]]nav[[end]]`, start)
+	writeInclude(t, assets, "2/head.tmpl", `[[define "headinclude"]]board two[[end]]`, start)
+	writeInclude(t, assets, "partials/head.tmpl", `[[define "headinclude"]]partial[[end]]`, start)
+
+	r, err := NewRenderer(assets)
+	assert.NoError(t, err, "An error was not expected")
+
+	// the controllers select the board with the ib in the template data
+	board := func(ib uint, name string) string {
+		var buf bytes.Buffer
+		r.Instance("index", map[string]interface{}{"ib": ib}).(render.HTML).Template.ExecuteTemplate(&buf, name, nil)
+		return buf.String()
+	}
+
+	assert.Equal(t, "global", renderInclude(r), "Global set should not see the overrides")
+	assert.Equal(t, "global", board(1, "headinclude"), "Board without overrides should use the global include")
+	assert.Equal(t, "board two", board(2, "headinclude"), "Board should use its own include")
+	assert.Equal(t, "nav", board(2, "navmenuinclude"), "Board should fall back to the global include")
+
+	assert.Equal(t, r.Template(), r.Instance("index", nil).(render.HTML).Template, "Instance should default to the global set")
+
+	changed, err := r.changed()
+	assert.NoError(t, err, "An error was not expected")
+	assert.Empty(t, changed, "Nothing should have changed")
+
+	// a broken board include keeps the current set
+	writeInclude(t, assets, "2/head.tmpl", `[[define "headinclude"]][[ template "nonexistent" ]][[end]]`, start.Add(time.Minute))
+
+	changed, err = r.changed()
+	assert.NoError(t, err, "An error was not expected")
+	assert.Equal(t, []string{filepath.Join("2", "head.tmpl")}, changed, "Board include changes should be reported")
+
+	assert.Error(t, r.Reload(), "Board include that cant render the index should fail")
+	assert.Equal(t, "board two", board(2, "headinclude"), "Failed reload should keep the current templates")
+}
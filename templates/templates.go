@@ -1,5 +1,15 @@
 package templates
 
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
 // Index template
 const Index = `[[define "index"]]<!doctype html>
 <html ng-app="prim" ng-strict-di lang="en">
@@ -9,37 +19,59 @@ const Index = `[[define "index"]]<!doctype html>
 <div class="header">
 [[template "header" . ]]
 </div>
-<div ng-view></div>
+<div ng-view></div>[[ with .noscript ]]
+<noscript>
+<ol class="noscript">[[ range .Items ]]
+<li>[[ if .Link ]]<a href="[[ .Link ]]">[[ .Title ]]</a>[[ else ]]<strong>[[ .Title ]]</strong>[[ end ]][[ if .Thumbnail ]]
+<img src="[[ .Thumbnail ]]" alt="" loading="lazy" />[[ end ]][[ if .Text ]]
+<p>[[ .Text ]]</p>[[ end ]]</li>[[ end ]]
+</ol>
+</noscript>[[ end ]]
 </body>
 </html>[[end]]`
 
 // Head items
 const Head = `[[define "head"]]<head>
 <base href="/[[ .base ]]">
-<title ng-bind="page.title">[[ .title ]]</title>
+<title ng-bind="page.title">[[ or .page_title .title ]]</title>
 <meta charset="utf-8" />
 <meta name="viewport" content="width=device-width, initial-scale=1" />
-<meta name="description" content="[[ .desc ]]" />[[if .nsfw]]
+<meta name="description" content="[[ or .page_desc .desc ]]" />[[ with .robots ]]
+<meta name="robots" content="[[ . ]]" />[[ end ]][[ with .canonical ]]
+<link rel="canonical" href="[[ . ]]" />[[ end ]][[ with .prev ]]
+<link rel="prev" href="[[ . ]]" />[[ end ]][[ with .next ]]
+<link rel="next" href="[[ . ]]" />[[ end ]]
+<meta property="og:site_name" content="[[ .og.Site ]]" />
+<meta property="og:type" content="website" />
+<meta property="og:title" content="[[ .og.Title ]]" />
+<meta property="og:description" content="[[ .og.Desc ]]" />
+<meta property="og:url" content="[[ .og.URL ]]" />[[ if .og.Image ]]
+<meta property="og:image" content="[[ .og.Image ]]" />[[ end ]]
+<meta name="twitter:card" content="[[ .og.Card ]]" />
+<meta name="twitter:title" content="[[ .og.Title ]]" />
+<meta name="twitter:description" content="[[ .og.Desc ]]" />[[ if .og.Image ]]
+<meta name="twitter:image" content="[[ .og.Image ]]" />[[ end ]][[if .nsfw]]
 <meta name="rating" content="adult" />
 <meta name="rating" content="RTA-5042-1996-1400-1577-RTA" />
 [[end]]
-<link rel="stylesheet" href="/assets/prim/[[ .primcss ]]" />
-<link rel="stylesheet" href="/assets/styles/[[ .style ]]" />
-<link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/font-awesome/4.4.0/css/font-awesome.min.css">
-<script src="/assets/prim/[[ .primjs ]]"></script>
+<link rel="stylesheet" href="/assets/prim/[[ .primcss ]]"[[ if .primcss_integrity ]] integrity="[[ .primcss_integrity ]]" crossorigin="anonymous"[[ end ]] />
+<link rel="stylesheet" href="/assets/styles/[[ .style ]]" />[[ if .fontawesome ]]
+<link rel="stylesheet" href="[[ .fontawesome ]]"[[ if .fontawesome_integrity ]] integrity="[[ .fontawesome_integrity ]]" crossorigin="anonymous"[[ end ]]>[[ end ]]
+<script[[ if .nonce ]] nonce="[[ .nonce ]]"[[ end ]] src="/assets/prim/[[ .primjs ]]"[[ if .primjs_integrity ]] integrity="[[ .primjs_integrity ]]" crossorigin="anonymous"[[ end ]]></script>
 [[template "angular" . ]][[template "headinclude" . ]]
 </head>[[end]]`
 
 // Angular config
-const Angular = `[[define "angular"]]<script>
+const Angular = `[[define "angular"]]<script[[ if .nonce ]] nonce="[[ .nonce ]]"[[ end ]]>
 angular.module('prim').constant('config',{
 ib_id:[[ .ib ]],
 title:'[[ .title ]]',
 img_srv:'//[[ .imgsrv ]]',
 api_srv:'//[[ .apisrv ]]',
-csrf_token:'[[ .csrf ]]'[[ if .discord ]],
-discord_widget:'[[ .discord ]]'
-[[end]]
+csrf_token:[[ if .cacheable ]](document.cookie.match(/(?:^|; )XSRF-TOKEN=([^;]*)/)||[])[1][[ else ]]'[[ .csrf ]]'[[ end ]][[ if .discord ]],
+discord_widget:'[[ .discord ]]'[[ if .cacheable ]]+'?[[ .ib ]]'+Math.floor(Date.now()/1000)[[ end ]]
+[[end]][[ with .error ]],
+error:{status:[[ .status ]],code:'[[ .code ]]',message:'[[ .message ]]'}[[end]]
 });
 </script>[[end]]`
 
@@ -95,3 +127,100 @@ const Navmenu = `[[define "navmenu"]][[ range $ib := .imageboards]]<li><a target
 // Empty includes for template parsing
 const HeadInclude = `[[define "headinclude"]][[end]]`
 const NavMenuInclude = `[[define "navmenuinclude"]][[end]]`
+
+// Load parses the templates with the includes from the assets directory
+func Load(assetsDir string) (*template.Template, error) {
+	t := template.New("templates").Delims("[[", "]]")
+
+	// the empty includes are replaced by the files in the includes directory
+	for _, tmpl := range []string{Index, Head, Header, Navmenu, Angular, HeadInclude, NavMenuInclude} {
+		_, err := t.Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	includes, err := filepath.Glob(filepath.Join(assetsDir, "includes", "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(includes) > 0 {
+		_, err = t.ParseFiles(includes...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Set is the global templates with the per imageboard overrides
+type Set struct {
+	Global *template.Template
+	Boards map[uint]*template.Template
+}
+
+// Lookup returns the templates for an imageboard, falling back to the global templates
+func (s *Set) Lookup(ib uint) *template.Template {
+	if t, ok := s.Boards[ib]; ok {
+		return t
+	}
+	return s.Global
+}
+
+// LoadSet parses the global templates and the overrides in includes/<ib_id>/*.tmpl,
+// every imageboard directory is parsed over a copy of the global templates
+func LoadSet(assetsDir string) (*Set, error) {
+	global, err := Load(assetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{
+		Global: global,
+		Boards: make(map[uint]*template.Template),
+	}
+
+	dirs, err := os.ReadDir(filepath.Join(assetsDir, "includes"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return set, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		// only imageboard ids are used
+		ib, err := strconv.ParseUint(dir.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		includes, err := filepath.Glob(filepath.Join(assetsDir, "includes", dir.Name(), "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(includes) == 0 {
+			continue
+		}
+
+		t, err := global.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = t.ParseFiles(includes...)
+		if err != nil {
+			return nil, fmt.Errorf("imageboard %d: %w", ib, err)
+		}
+
+		set.Boards[uint(ib)] = t
+	}
+
+	return set, nil
+}
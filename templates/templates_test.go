@@ -1,7 +1,10 @@
 package templates
 
 import (
+	"bytes"
 	"html/template"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +44,27 @@ func TestTemplatesParsing(t *testing.T) {
 		assert.NotNil(t, tmpl.Lookup(name), "Template '%s' should be defined", name)
 	}
 }
+
+func TestLoad(t *testing.T) {
+	assets := t.TempDir()
+
+	// without includes the empty defaults are used
+	tmpl, err := Load(assets)
+	assert.NoError(t, err, "Templates should load without includes")
+	assert.NotNil(t, tmpl.Lookup("headinclude"), "Empty headinclude should be defined")
+
+	assert.NoError(t, os.Mkdir(filepath.Join(assets, "includes"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(assets, "includes", "nav.tmpl"), []byte(`[[define "navmenuinclude"]]<li>extra</li>[[end]]`), 0644))
+
+	tmpl, err = Load(assets)
+	assert.NoError(t, err, "Templates should load with includes")
+
+	var buf bytes.Buffer
+	assert.NoError(t, tmpl.ExecuteTemplate(&buf, "navmenuinclude", nil))
+	assert.Equal(t, "<li>extra</li>", buf.String(), "Include should replace the empty default")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(assets, "includes", "bad.tmpl"), []byte(`[[define "broken"]]`), 0644))
+
+	_, err = Load(assets)
+	assert.Error(t, err, "Broken includes should return an error")
+}